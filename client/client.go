@@ -3,49 +3,65 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"sync"
 
 	"github.com/andyleap/nostr/common"
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip42"
+	"github.com/andyleap/nostr/signer"
 	"nhooyr.io/websocket"
 )
 
 type Client struct {
 	conn *websocket.Conn
+	url  string
 
 	subs map[string]*Subscription
+	oks  map[string]chan *comm.OK
 	mu   sync.Mutex
+
+	challenge   string
+	challengeCh chan struct{}
+	done        chan struct{}
 }
 
 func Dial(ctx context.Context, url string) (*Client, error) {
 	conn, _, err := websocket.Dial(ctx, url, nil)
-	conn.SetReadLimit(1024 * 1024 * 1024)
 	if err != nil {
 		return nil, err
 	}
+	conn.SetReadLimit(1024 * 1024 * 1024)
 
 	c := &Client{
-		conn: conn,
-		subs: make(map[string]*Subscription),
+		conn:        conn,
+		url:         url,
+		subs:        make(map[string]*Subscription),
+		oks:         make(map[string]chan *comm.OK),
+		challengeCh: make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 	go c.process()
 	return c, nil
 }
 
 func (c *Client) process() {
+	defer close(c.done)
 	ctx := context.Background()
 	for {
 		mt, buf, err := c.conn.Read(ctx)
 		if err != nil {
 			c.Close()
+			return
 		}
 		if mt != websocket.MessageText {
 			c.Close()
+			return
 		}
 		resp, err := comm.ParseResp(buf)
 		if err != nil {
-			c.Close()
+			continue
 		}
 		switch resp := resp.(type) {
 		case *comm.Event:
@@ -78,10 +94,74 @@ func (c *Client) process() {
 				b, _ := json.Marshal(closesub)
 				c.conn.Write(ctx, websocket.MessageText, b)
 			}
+		case *comm.OK:
+			c.mu.Lock()
+			ch, ok := c.oks[resp.ID]
+			delete(c.oks, resp.ID)
+			c.mu.Unlock()
+			if ok {
+				ch <- resp
+			}
+		case *comm.AuthChallenge:
+			c.mu.Lock()
+			first := c.challenge == ""
+			c.challenge = resp.Challenge
+			c.mu.Unlock()
+			if first {
+				close(c.challengeCh)
+			}
+		}
+	}
+}
+
+// Auth answers the relay's NIP-42 challenge, waiting for the challenge to
+// arrive if necessary, and returns once the relay has accepted it.
+func (c *Client) Auth(ctx context.Context, s signer.Signer) error {
+	select {
+	case <-c.challengeCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	challenge := c.challenge
+	c.mu.Unlock()
+
+	e := nip42.NewAuthEvent(c.url, challenge)
+	err := s.SignEvent(ctx, e)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *comm.OK, 1)
+	c.mu.Lock()
+	c.oks[e.ID] = ch
+	c.mu.Unlock()
+	b, err := (&comm.Auth{Event: e}).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	err = c.conn.Write(ctx, websocket.MessageText, b)
+	if err != nil {
+		return err
+	}
+	select {
+	case ok := <-ch:
+		if !ok.Accepted {
+			return errors.New("auth rejected: " + ok.Msg)
 		}
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.oks, e.ID)
+		c.mu.Unlock()
+		return ctx.Err()
 	}
 }
 
+// Done is closed once the connection to the relay is gone.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
 func (c *Client) Close() error {
 	return c.conn.Close(websocket.StatusNormalClosure, "")
 }
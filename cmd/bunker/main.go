@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/signer/nip46"
+	"github.com/jessevdk/go-flags"
+)
+
+type config struct {
+	Keys    []string
+	Relays  []string
+	Secrets []secret
+	Clients []grant
+}
+
+type secret struct {
+	Secret string
+	Perms  string
+}
+
+type grant struct {
+	PubKey string
+	Client string
+	Perms  string
+}
+
+var CLI struct {
+	ConfigFile string `long:"config" description:"Config file" default:"bunker.json"`
+	Run        Run    `command:"run" description:"Answer signing requests"`
+	Key        struct {
+		Generate KeyGenerate `command:"generate" description:"Generate and store a new key"`
+		Import   KeyImport   `command:"import" description:"Store an existing key (hex or nsec)"`
+		List     KeyList     `command:"list" description:"List the stored keys"`
+	} `command:"key" description:"Manage keys"`
+	Relay struct {
+		Add RelayAdd `command:"add" description:"Listen for requests on a relay"`
+	} `command:"relay" description:"Manage relays"`
+	URI   URI   `command:"uri" description:"Create a single use bunker:// connection string"`
+	Allow Allow `command:"allow" description:"Grant a client key permissions"`
+}
+
+func (cfg config) pubKey(key string) (string, error) {
+	if len(cfg.Keys) == 0 {
+		return "", errors.New("no keys in config")
+	}
+	if key == "" {
+		k, err := nip19.DecodePrivateKey(cfg.Keys[0])
+		if err != nil {
+			return "", err
+		}
+		return common.PubKeyHex(k.PubKey()), nil
+	}
+	return nip19.DecodePubKey(key)
+}
+
+type Run struct{}
+
+func (r *Run) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if len(cfg.Keys) == 0 || len(cfg.Relays) == 0 {
+		return errors.New("no keys or relays in config")
+	}
+	b := nip46.NewBunker()
+	for _, k := range cfg.Keys {
+		key, err := nip19.DecodePrivateKey(k)
+		if err != nil {
+			return err
+		}
+		b.AddKey(key)
+	}
+	for _, s := range cfg.Secrets {
+		b.AddSecret(s.Secret, nip46.ParsePermissions(s.Perms))
+	}
+	for _, g := range cfg.Clients {
+		b.Allow(g.PubKey, g.Client, nip46.ParsePermissions(g.Perms))
+	}
+
+	var mu sync.Mutex
+	b.OnConnect = func(pubKey, clientPubKey, used string, perms nip46.Permissions) {
+		mu.Lock()
+		defer mu.Unlock()
+		log.Printf("client %s connected to %s with %q", clientPubKey, pubKey, perms.String())
+		cfg := loadJSONConfig(CLI.ConfigFile)
+		for i, s := range cfg.Secrets {
+			if s.Secret == used {
+				cfg.Secrets = append(cfg.Secrets[:i], cfg.Secrets[i+1:]...)
+				break
+			}
+		}
+		cfg.Clients = append(cfg.Clients, grant{
+			PubKey: pubKey,
+			Client: clientPubKey,
+			Perms:  perms.String(),
+		})
+		err := saveJSONConfig(CLI.ConfigFile, cfg)
+		if err != nil {
+			log.Println("saving config:", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, relay := range cfg.Relays {
+		wg.Add(1)
+		go func(relay string) {
+			defer wg.Done()
+			for {
+				c, err := client.Dial(context.Background(), relay)
+				if err == nil {
+					log.Println("listening on", relay)
+					err = b.Serve(context.Background(), c)
+					c.Close()
+				}
+				log.Printf("%s: %v", relay, err)
+				time.Sleep(5 * time.Second)
+			}
+		}(relay)
+	}
+	wg.Wait()
+	return nil
+}
+
+type KeyGenerate struct{}
+
+func (k *KeyGenerate) Execute(args []string) error {
+	key := common.GeneratePrivateKey()
+	nsec, err := nip19.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Keys = append(cfg.Keys, nsec)
+	npub, _ := nip19.EncodePubKey(common.PubKeyHex(key.PubKey()))
+	fmt.Printf("Public Key: %s\n", npub)
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+type KeyImport struct{}
+
+func (k *KeyImport) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a single argument")
+	}
+	key, err := nip19.DecodePrivateKey(args[0])
+	if err != nil {
+		return err
+	}
+	nsec, _ := nip19.EncodePrivateKey(key)
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Keys = append(cfg.Keys, nsec)
+	npub, _ := nip19.EncodePubKey(common.PubKeyHex(key.PubKey()))
+	fmt.Printf("Public Key: %s\n", npub)
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+type KeyList struct{}
+
+func (k *KeyList) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	for _, s := range cfg.Keys {
+		key, err := nip19.DecodePrivateKey(s)
+		if err != nil {
+			return err
+		}
+		pk := common.PubKeyHex(key.PubKey())
+		npub, _ := nip19.EncodePubKey(pk)
+		fmt.Printf("%s %s\n", npub, pk)
+	}
+	return nil
+}
+
+type RelayAdd struct{}
+
+func (r *RelayAdd) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a single argument")
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Relays = append(cfg.Relays, args[0])
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+type URI struct {
+	Key   string `long:"key" description:"Public key to hand out (defaults to the first key)"`
+	Perms string `long:"perms" description:"Comma separated methods, sign_event:<kind> for a single kind" required:"true"`
+}
+
+func (u *URI) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if len(cfg.Relays) == 0 {
+		return errors.New("no relays in config")
+	}
+	pk, err := cfg.pubKey(u.Key)
+	if err != nil {
+		return err
+	}
+	s := secret{
+		Secret: common.RandID(),
+		Perms:  u.Perms,
+	}
+	cfg.Secrets = append(cfg.Secrets, s)
+	err = saveJSONConfig(CLI.ConfigFile, cfg)
+	if err != nil {
+		return err
+	}
+	uri := &nip46.BunkerURI{
+		PubKey: pk,
+		Relays: cfg.Relays,
+		Secret: s.Secret,
+	}
+	fmt.Println(uri.String())
+	return nil
+}
+
+type Allow struct {
+	Key    string `long:"key" description:"Public key the client may use (defaults to the first key)"`
+	Client string `long:"client" description:"Client public key" required:"true"`
+	Perms  string `long:"perms" description:"Comma separated methods, sign_event:<kind> for a single kind" required:"true"`
+}
+
+func (a *Allow) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	pk, err := cfg.pubKey(a.Key)
+	if err != nil {
+		return err
+	}
+	clientPK, err := nip19.DecodePubKey(a.Client)
+	if err != nil {
+		return err
+	}
+	for i, g := range cfg.Clients {
+		if g.PubKey == pk && g.Client == clientPK {
+			cfg.Clients = append(cfg.Clients[:i], cfg.Clients[i+1:]...)
+			break
+		}
+	}
+	cfg.Clients = append(cfg.Clients, grant{
+		PubKey: pk,
+		Client: clientPK,
+		Perms:  a.Perms,
+	})
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+func main() {
+	flags.Parse(&CLI)
+}
+
+func loadJSONConfig(filename string) config {
+	var cfg config
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg
+	}
+	json.Unmarshal(buf, &cfg)
+	return cfg
+}
+
+func saveJSONConfig(filename string, cfg config) error {
+	buf, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0600)
+}
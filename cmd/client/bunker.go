@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/signer/nip46"
+)
+
+type BunkerConnect struct {
+	Perms string `long:"perms" description:"Permissions to ask the bunker for" default:"sign_event,nip04_encrypt,nip04_decrypt,nip44_encrypt,nip44_decrypt"`
+}
+
+func (b *BunkerConnect) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	u, err := nip46.ParseBunkerURI(args[0])
+	if err != nil {
+		return err
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.ClientKey == nil {
+		cfg.ClientKey = &privkey{PrivateKey: common.GeneratePrivateKey()}
+	}
+	r, err := nip46.Connect(context.Background(), args[0], cfg.ClientKey.PrivateKey, nip46.ParsePermissions(b.Perms))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	pk, err := r.GetPublicKey(context.Background())
+	if err != nil {
+		return err
+	}
+	// the secret is single use, and the bunker knows our client key now
+	u.Secret = ""
+	cfg.Bunker = u.String()
+	err = saveJSONConfig(CLI.ConfigFile, cfg)
+	if err != nil {
+		return err
+	}
+	npub, _ := nip19.EncodePubKey(pk)
+	fmt.Printf("Connected to bunker, signing as %s\n", npub)
+	return nil
+}
+
+type BunkerForget struct{}
+
+func (b *BunkerForget) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Bunker = ""
+	cfg.ClientKey = nil
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+type DelegateCreate struct {
+	To    string  `long:"to" description:"Delegatee public key (hex, npub or nprofile)" required:"true"`
+	Kinds []int64 `long:"kind" description:"Kind the delegatee may publish, may be repeated (default any)"`
+	Days  int     `long:"days" description:"Days the delegation is valid for" default:"30"`
+}
+
+func (d *DelegateCreate) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Key == nil {
+		return errors.New("delegating needs a local key in config")
+	}
+	key, err := cfg.Key.key()
+	if err != nil {
+		return err
+	}
+	to, err := nip19.DecodePubKey(d.To)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tag, err := proto.NewDelegation(key, to, &proto.Conditions{
+		Kinds:  d.Kinds,
+		After:  now.Add(-time.Minute).Unix(),
+		Before: now.AddDate(0, 0, d.Days).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	buf, _ := json.Marshal(tag)
+	fmt.Printf("%s\n", buf)
+	return nil
+}
+
+type DelegateUse struct{}
+
+func (d *DelegateUse) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	var tag []string
+	err := json.Unmarshal([]byte(args[0]), &tag)
+	if err != nil {
+		return err
+	}
+	if len(tag) != 4 || tag[0] != proto.TagDelegation {
+		return errors.New("not a delegation tag")
+	}
+	if _, err := proto.ParseConditions(tag[2]); err != nil {
+		return err
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Delegation = tag
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+type DelegateClear struct{}
+
+func (d *DelegateClear) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Delegation = nil
+	return saveJSONConfig(CLI.ConfigFile, cfg)
+}
+
+// delegate adds the configured delegation to e if its conditions allow
+// the event.
+func (cfg config) delegate(e *proto.Event) {
+	if len(cfg.Delegation) != 4 {
+		return
+	}
+	c, err := proto.ParseConditions(cfg.Delegation[2])
+	if err != nil || !c.Allows(e.Kind, e.CreatedAt) {
+		return
+	}
+	e.SetDelegation(cfg.Delegation)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip04"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+type DMSend struct {
+	To      string `long:"to" description:"Recipient public key (hex, npub or nprofile)" required:"true"`
+	Content string `long:"content" description:"Message" required:"true"`
+}
+
+func (d *DMSend) Execute(args []string) error {
+	ctx := context.Background()
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(ctx)
+	if err != nil {
+		return err
+	}
+	to, err := nip19.DecodePubKey(d.To)
+	if err != nil {
+		return err
+	}
+	content, err := sig.Nip04Encrypt(ctx, to, d.Content)
+	if err != nil {
+		return err
+	}
+	event := &proto.Event{
+		Kind:      nip04.KindEncryptedDirectMessage,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			{"p", to},
+		},
+		Content: content,
+	}
+	err = sig.SignEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	buf, _ := json.Marshal(event)
+	fmt.Printf("%s\n", buf)
+	c, err := client.Dial(context.Background(), cfg.Relay)
+	if err != nil {
+		return err
+	}
+	return c.Publish(context.Background(), event)
+}
+
+type DMRead struct {
+	With  string `long:"with" description:"Other party's public key (hex, npub or nprofile)" required:"true"`
+	Limit int64  `long:"limit" description:"Maximum number of messages in each direction" default:"100"`
+}
+
+func (d *DMRead) Execute(args []string) error {
+	ctx := context.Background()
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(ctx)
+	if err != nil {
+		return err
+	}
+	with, err := nip19.DecodePubKey(d.With)
+	if err != nil {
+		return err
+	}
+	me, err := sig.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	c, err := client.Dial(context.Background(), cfg.Relay)
+	if err != nil {
+		return err
+	}
+	sub, err := c.Subscribe(context.Background(), &comm.Filter{
+		Kinds:      []int64{nip04.KindEncryptedDirectMessage},
+		Authors:    []string{me},
+		TagFilters: map[string][]string{"p": {with}},
+		Limit:      d.Limit,
+	}, &comm.Filter{
+		Kinds:      []int64{nip04.KindEncryptedDirectMessage},
+		Authors:    []string{with},
+		TagFilters: map[string][]string{"p": {me}},
+		Limit:      d.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	events := collectBackfill(sub, 10*time.Second)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt < events[j].CreatedAt
+	})
+	for _, e := range events {
+		other, err := nip04.Counterparty(e, me)
+		if err != nil || other != with {
+			continue
+		}
+		from := "them"
+		if e.PubKey == me {
+			from = "me"
+		}
+		pt, err := sig.Nip04Decrypt(ctx, other, e.Content)
+		if err != nil {
+			pt = fmt.Sprintf("<unable to decrypt: %v>", err)
+		}
+		fmt.Printf("%s [%s] %s\n", time.Unix(e.CreatedAt, 0).Format(time.RFC3339), from, pt)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip06"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/proto/nip49"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/term"
+)
+
+// passphraseEnv can hold the passphrase for scripts, in place of the
+// prompt.
+const passphraseEnv = "NOSTR_PASSPHRASE"
+
+var errPassphraseMismatch = errors.New("passphrases do not match")
+
+// stdin is shared so that successive prompts don't lose buffered input.
+var stdin = bufio.NewReader(os.Stdin)
+
+func readPassphrase(prompt string) (string, error) {
+	if pass, ok := os.LookupEnv(passphraseEnv); ok {
+		return pass, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	buf, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func newPassphrase() (string, error) {
+	pass, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if _, ok := os.LookupEnv(passphraseEnv); ok || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return pass, nil
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != pass {
+		return "", errPassphraseMismatch
+	}
+	return pass, nil
+}
+
+// newPrivkey wraps key for the config, encrypting it with a new
+// passphrase unless plain is set.
+func newPrivkey(key *secp256k1.PrivateKey, plain bool, ks nip49.KeySecurity) (*privkey, error) {
+	if plain {
+		return &privkey{PrivateKey: key}, nil
+	}
+	pass, err := newPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := nip49.Encrypt(key, pass, nip49.DefaultLogN, ks)
+	if err != nil {
+		return nil, err
+	}
+	return &privkey{PrivateKey: key, encrypted: enc}, nil
+}
+
+type KeyImport struct {
+	Plain bool `long:"plain" description:"Save the key without encrypting it"`
+}
+
+func (k *KeyImport) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	var priv *privkey
+	if strings.HasPrefix(args[0], nip49.Prefix+"1") {
+		pass, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		key, _, err := nip49.Decrypt(args[0], pass)
+		if err != nil {
+			return err
+		}
+		priv = &privkey{PrivateKey: key}
+		if !k.Plain {
+			priv.encrypted = args[0]
+		}
+	} else {
+		key, err := nip19.DecodePrivateKey(args[0])
+		if err != nil {
+			return err
+		}
+		// it has been on a command line, so it can't be considered safe
+		priv, err = newPrivkey(key, k.Plain, nip49.KeyInsecure)
+		if err != nil {
+			return err
+		}
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Key = priv
+	err := saveJSONConfig(CLI.ConfigFile, cfg)
+	if err != nil {
+		return err
+	}
+	npub, _ := nip19.EncodePubKey(common.PubKeyHex(priv.PubKey()))
+	fmt.Printf("Public Key: %s\n", npub)
+	return nil
+}
+
+type KeyRecover struct {
+	Plain          bool   `long:"plain" description:"Save the key without encrypting it"`
+	Account        uint32 `long:"account" description:"Account index to derive"`
+	SeedPassphrase string `long:"seed-passphrase" description:"BIP-39 passphrase the seed phrase was created with"`
+}
+
+func (k *KeyRecover) Execute(args []string) error {
+	m := strings.Join(args, " ")
+	if m == "" {
+		fmt.Fprint(os.Stderr, "Seed phrase: ")
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		m = line
+	}
+	key, err := nip06.PrivateKeyFromMnemonic(m, k.SeedPassphrase, k.Account)
+	if err != nil {
+		return err
+	}
+	priv, err := newPrivkey(key, k.Plain, nip49.KeySecurityUnknown)
+	if err != nil {
+		return err
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Key = priv
+	err = saveJSONConfig(CLI.ConfigFile, cfg)
+	if err != nil {
+		return err
+	}
+	npub, _ := nip19.EncodePubKey(common.PubKeyHex(key.PubKey()))
+	fmt.Printf("Public Key: %s\n", npub)
+	return nil
+}
+
+type KeyExport struct {
+	Format string `long:"format" description:"Output format" choice:"ncryptsec" choice:"nsec" choice:"hex" default:"ncryptsec"`
+}
+
+func (k *KeyExport) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Key == nil {
+		return errors.New("no key in config")
+	}
+	if k.Format == "ncryptsec" && cfg.Key.encrypted != "" {
+		fmt.Println(cfg.Key.encrypted)
+		return nil
+	}
+	key, err := cfg.Key.key()
+	if err != nil {
+		return err
+	}
+	switch k.Format {
+	case "ncryptsec":
+		// stored in plain text until now
+		priv, err := newPrivkey(key, false, nip49.KeyInsecure)
+		if err != nil {
+			return err
+		}
+		fmt.Println(priv.encrypted)
+	case "nsec":
+		nsec, err := nip19.EncodePrivateKey(key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(nsec)
+	case "hex":
+		fmt.Println(hex.EncodeToString(key.Serialize()))
+	}
+	return nil
+}
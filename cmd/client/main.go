@@ -6,12 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/andyleap/nostr/client"
 	"github.com/andyleap/nostr/common"
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/kinds"
+	"github.com/andyleap/nostr/proto/nip06"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/proto/nip21"
+	"github.com/andyleap/nostr/proto/nip49"
+	"github.com/andyleap/nostr/signer"
+	"github.com/andyleap/nostr/signer/nip46"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/jessevdk/go-flags"
 )
@@ -19,13 +27,73 @@ import (
 type config struct {
 	Key   *privkey
 	Relay string
+
+	// Bunker is a bunker:// uri to sign with instead of Key, reached
+	// using ClientKey.
+	Bunker    string   `json:",omitempty"`
+	ClientKey *privkey `json:",omitempty"`
+
+	// Delegation is a NIP-26 delegation tag added to published events,
+	// so they are attributed to the delegator.
+	Delegation []string `json:",omitempty"`
+}
+
+// getSigner returns the bunker if one is configured, and the local key
+// otherwise.
+func (cfg config) getSigner(ctx context.Context) (signer.Signer, error) {
+	if cfg.Bunker != "" {
+		if cfg.ClientKey == nil {
+			return nil, errors.New("no client key for bunker in config")
+		}
+		return nip46.Connect(ctx, cfg.Bunker, cfg.ClientKey.PrivateKey, nil)
+	}
+	if cfg.Key == nil {
+		return nil, errors.New("no key in config")
+	}
+	key, err := cfg.Key.key()
+	if err != nil {
+		return nil, err
+	}
+	return signer.NewKeySigner(key), nil
 }
 
 type privkey struct {
 	*secp256k1.PrivateKey
+	// encrypted is the key as an ncryptsec, which is decrypted the first
+	// time the key is needed.
+	encrypted string
+}
+
+// key returns the private key, asking for the passphrase if it is
+// encrypted.
+func (p *privkey) key() (*secp256k1.PrivateKey, error) {
+	if p.PrivateKey != nil {
+		return p.PrivateKey, nil
+	}
+	pass, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := nip49.Decrypt(p.encrypted, pass)
+	if err != nil {
+		return nil, err
+	}
+	p.PrivateKey = key
+	return key, nil
 }
 
 func (p *privkey) UnmarshalJSON(buf []byte) error {
+	var s string
+	if json.Unmarshal(buf, &s) == nil {
+		if strings.HasPrefix(s, nip49.Prefix+"1") {
+			p.encrypted = s
+			return nil
+		}
+		if key, err := nip19.DecodePrivateKey(s); err == nil {
+			p.PrivateKey = key
+			return nil
+		}
+	}
 	var b []byte
 	json.Unmarshal(buf, &b)
 	if len(b) != 32 {
@@ -36,6 +104,9 @@ func (p *privkey) UnmarshalJSON(buf []byte) error {
 }
 
 func (p *privkey) MarshalJSON() ([]byte, error) {
+	if p.encrypted != "" {
+		return json.Marshal(p.encrypted)
+	}
 	return json.Marshal(p.PrivateKey.Serialize())
 }
 
@@ -44,6 +115,9 @@ var CLI struct {
 	Key        struct {
 		Generate `command:"generate" description:"Generate a new key"`
 		Show     `command:"show" description:"Show the current public key"`
+		Import   KeyImport  `command:"import" description:"Save a key given as nsec, ncryptsec or hex"`
+		Recover  KeyRecover `command:"recover" description:"Save the key derived from a seed phrase"`
+		Export   KeyExport  `command:"export" description:"Print the saved key"`
 	} `command:"key" description:"Manage keys"`
 	Relay struct {
 		Set `command:"set" description:"Set the relay address"`
@@ -52,39 +126,94 @@ var CLI struct {
 		Metadata `command:"metadata" description:"Publish metadata"`
 		Note     `command:"note" description:"Publish a note"`
 	} `command:"publish" description:"Publish data"`
-	Query `command:"query" description:"Query data"`
+	DM struct {
+		Send DMSend `command:"send" description:"Send an encrypted direct message"`
+		Read DMRead `command:"read" description:"Read the conversation with a public key"`
+	} `command:"dm" description:"Encrypted direct messages (NIP-04)"`
+	PM struct {
+		Send  PMSend  `command:"send" description:"Send a gift wrapped private message"`
+		List  PMList  `command:"list" description:"List private messages"`
+		Inbox PMInbox `command:"inbox" description:"Publish the relays you receive private messages on"`
+	} `command:"pm" description:"Private direct messages (NIP-17)"`
+	Query    `command:"query" description:"Query data"`
+	Reply    `command:"reply" description:"Publish a reply to an event"`
+	Thread   `command:"thread" description:"Show the thread an event is in"`
+	Decode   `command:"decode" description:"Decode a NIP-19 entity"`
+	Delegate struct {
+		Create DelegateCreate `command:"create" description:"Let another key publish on your behalf"`
+		Use    DelegateUse    `command:"use" description:"Publish on behalf of the delegator in a delegation tag"`
+		Clear  DelegateClear  `command:"clear" description:"Stop publishing on someone else's behalf"`
+	} `command:"delegate" description:"Delegated event signing (NIP-26)"`
+	Bunker struct {
+		Connect BunkerConnect `command:"connect" description:"Sign with a remote bunker instead of a local key"`
+		Forget  BunkerForget  `command:"forget" description:"Stop using the bunker"`
+	} `command:"bunker" description:"Manage the remote signer (NIP-46)"`
+	Encode struct {
+		NPub     EncodeNPub     `command:"npub" description:"Encode a hex public key"`
+		NSec     EncodeNSec     `command:"nsec" description:"Encode a hex private key"`
+		Note     EncodeNote     `command:"note" description:"Encode a hex event id"`
+		NProfile EncodeNProfile `command:"nprofile" description:"Encode a profile pointer"`
+		NEvent   EncodeNEvent   `command:"nevent" description:"Encode an event pointer"`
+		NAddr    EncodeNAddr    `command:"naddr" description:"Encode a parameterized replaceable event address"`
+		NRelay   EncodeNRelay   `command:"nrelay" description:"Encode a relay url"`
+	} `command:"encode" description:"Encode a NIP-19 entity"`
 }
 
 type Generate struct {
-	Save bool `long:"save" description:"Save the key to the config file"`
+	Save     bool   `long:"save" description:"Save the key to the config file"`
+	Plain    bool   `long:"plain" description:"Save the key without encrypting it"`
+	Mnemonic bool   `long:"mnemonic" description:"Derive the key from a new seed phrase (NIP-06)"`
+	Words    int    `long:"words" description:"Seed phrase length" choice:"12" choice:"24" default:"12"`
+	Account  uint32 `long:"account" description:"Account index to derive"`
 }
 
 func (g *Generate) Execute(args []string) error {
 	key := common.GeneratePrivateKey()
+	if g.Mnemonic {
+		m, err := nip06.NewMnemonic(g.Words / 3 * 32)
+		if err != nil {
+			return err
+		}
+		key, err = nip06.PrivateKeyFromMnemonic(m, "", g.Account)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Seed Phrase: %s\n", m)
+	}
 	pubHex := common.PubKeyHex(key.PubKey())
-	priv := privkey{key}
-	fmt.Printf("Public Key: %s\n", pubHex)
-	buf, _ := priv.MarshalJSON()
-	fmt.Printf("Private Key: %s\n", buf)
-
-	if g.Save {
-		cfg := loadJSONConfig(CLI.ConfigFile)
-		cfg.Key = &priv
-		saveJSONConfig(CLI.ConfigFile, cfg)
+	npub, _ := nip19.EncodePubKey(pubHex)
+	fmt.Printf("Public Key: %s\n", npub)
+	fmt.Printf("Public Key (hex): %s\n", pubHex)
+	if !g.Save {
+		nsec, _ := nip19.EncodePrivateKey(key)
+		fmt.Printf("Private Key: %s\n", nsec)
+		return nil
 	}
 
-	return nil
+	priv, err := newPrivkey(key, g.Plain, nip49.KeySecure)
+	if err != nil {
+		return err
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	cfg.Key = priv
+	return saveJSONConfig(CLI.ConfigFile, cfg)
 }
 
 type Show struct{}
 
 func (s *Show) Execute(args []string) error {
 	cfg := loadJSONConfig(CLI.ConfigFile)
-	if cfg.Key == nil {
-		return errors.New("no key in config")
+	sig, err := cfg.getSigner(context.Background())
+	if err != nil {
+		return err
+	}
+	pubHex, err := sig.GetPublicKey(context.Background())
+	if err != nil {
+		return err
 	}
-	pubHex := common.PubKeyHex(cfg.Key.PubKey())
-	fmt.Printf("Public Key: %s\n", pubHex)
+	npub, _ := nip19.EncodePubKey(pubHex)
+	fmt.Printf("Public Key: %s\n", npub)
+	fmt.Printf("Public Key (hex): %s\n", pubHex)
 	return nil
 }
 
@@ -98,31 +227,41 @@ func (s *Set) Execute(args []string) error {
 }
 
 type Metadata struct {
-	Name  string `long:"name" description:"Name" required:"true"`
-	About string `long:"about" description:"About" required:"true"`
+	Name        string `long:"name" description:"Name" required:"true"`
+	DisplayName string `long:"display-name" description:"Display name"`
+	About       string `long:"about" description:"About" required:"true"`
+	Picture     string `long:"picture" description:"Profile picture URL"`
+	Banner      string `long:"banner" description:"Banner image URL"`
+	Website     string `long:"website" description:"Website URL"`
+	NIP05       string `long:"nip05" description:"NIP-05 identifier"`
+	LUD16       string `long:"lud16" description:"Lightning address"`
 }
 
 func (m *Metadata) Execute(args []string) error {
 	cfg := loadJSONConfig(CLI.ConfigFile)
-	if cfg.Key == nil || cfg.Relay == "" {
-		return errors.New("no key or relay in config")
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
 	}
-	metadata := map[string]string{
-		"name":  m.Name,
-		"about": m.About,
-	}
-	buf, _ := json.Marshal(metadata)
-	event := &proto.Event{
-		Kind:      0,
-		Content:   string(buf),
-		CreatedAt: time.Now().Unix(),
-		Tags:      [][]string{},
+	sig, err := cfg.getSigner(context.Background())
+	if err != nil {
+		return err
 	}
-	event.Sign(cfg.Key.PrivateKey)
-	if !event.CheckSig() {
-		return errors.New("signature failed")
+	event := (&kinds.Metadata{
+		Name:        m.Name,
+		DisplayName: m.DisplayName,
+		About:       m.About,
+		Picture:     m.Picture,
+		Banner:      m.Banner,
+		Website:     m.Website,
+		NIP05:       m.NIP05,
+		LUD16:       m.LUD16,
+	}).Event()
+	cfg.delegate(event)
+	err = sig.SignEvent(context.Background(), event)
+	if err != nil {
+		return err
 	}
-	buf, _ = json.Marshal(event)
+	buf, _ := json.Marshal(event)
 	fmt.Printf("%s\n", buf)
 	c, err := client.Dial(context.Background(), cfg.Relay)
 	if err != nil {
@@ -137,8 +276,12 @@ type Note struct {
 
 func (n *Note) Execute(args []string) error {
 	cfg := loadJSONConfig(CLI.ConfigFile)
-	if cfg.Key == nil || cfg.Relay == "" {
-		return errors.New("no key or relay in config")
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(context.Background())
+	if err != nil {
+		return err
 	}
 	event := &proto.Event{
 		Kind:      1,
@@ -146,9 +289,11 @@ func (n *Note) Execute(args []string) error {
 		CreatedAt: time.Now().Unix(),
 		Tags:      [][]string{},
 	}
-	event.Sign(cfg.Key.PrivateKey)
-	if !event.CheckSig() {
-		return errors.New("signature failed")
+	nip21.AddTags(event)
+	cfg.delegate(event)
+	err = sig.SignEvent(context.Background(), event)
+	if err != nil {
+		return err
 	}
 	buf, _ := json.Marshal(event)
 	fmt.Printf("%s\n", buf)
@@ -161,13 +306,14 @@ func (n *Note) Execute(args []string) error {
 
 type Query struct {
 	Kind   int    `long:"kind" description:"Kind of event to query" default:"-1"`
-	PubKey string `long:"pubkey" description:"Public key to query"`
+	PubKey string `long:"pubkey" description:"Public key to query (hex, npub or nprofile)"`
+	ID     string `long:"id" description:"Event id to query (hex, note or nevent)"`
 }
 
 func (q *Query) Execute(args []string) error {
 	cfg := loadJSONConfig(CLI.ConfigFile)
-	if cfg.Key == nil || cfg.Relay == "" {
-		return errors.New("no key or relay in config")
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
 	}
 	c, err := client.Dial(context.Background(), cfg.Relay)
 	if err != nil {
@@ -178,7 +324,18 @@ func (q *Query) Execute(args []string) error {
 		f.Kinds = []int64{int64(q.Kind)}
 	}
 	if q.PubKey != "" {
-		f.Authors = []string{q.PubKey}
+		pk, err := nip19.DecodePubKey(q.PubKey)
+		if err != nil {
+			return err
+		}
+		f.Authors = []string{pk}
+	}
+	if q.ID != "" {
+		id, err := nip19.DecodeEventID(q.ID)
+		if err != nil {
+			return err
+		}
+		f.IDs = []string{id}
 	}
 	sub, err := c.Subscribe(context.Background(), f)
 	if err != nil {
@@ -198,6 +355,38 @@ func (q *Query) Execute(args []string) error {
 	}
 }
 
+// collectBackfill gathers the stored events of a subscription, stopping at
+// EOSE or after timeout, and drops duplicates and bad signatures.
+func collectBackfill(sub *client.Subscription, timeout time.Duration) []*proto.Event {
+	seen := map[string]bool{}
+	var events []*proto.Event
+	add := func(e *proto.Event) {
+		if e == nil || seen[e.ID] || !e.CheckSig() {
+			return
+		}
+		seen[e.ID] = true
+		events = append(events, e)
+	}
+	t := time.After(timeout)
+	for {
+		select {
+		case e := <-sub.Events():
+			add(e)
+		case <-sub.Backfilling():
+			for {
+				select {
+				case e := <-sub.Events():
+					add(e)
+				default:
+					return events
+				}
+			}
+		case <-t:
+			return events
+		}
+	}
+}
+
 func main() {
 	flags.Parse(&CLI)
 
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+var errNoArg = errors.New("expected a single argument")
+
+type Decode struct{}
+
+func (d *Decode) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	prefix, v, err := nip19.Decode(args[0])
+	if err != nil {
+		return err
+	}
+	if key, ok := v.(*secp256k1.PrivateKey); ok {
+		v = map[string]string{
+			"privkey": hex.EncodeToString(key.Serialize()),
+			"pubkey":  common.PubKeyHex(key.PubKey()),
+		}
+	}
+	buf, _ := json.Marshal(map[string]interface{}{
+		"type":  prefix,
+		"value": v,
+	})
+	fmt.Printf("%s\n", buf)
+	return nil
+}
+
+type EncodeNPub struct{}
+
+func (e *EncodeNPub) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	pk, err := nip19.DecodePubKey(args[0])
+	if err != nil {
+		return err
+	}
+	return printEncoded(nip19.EncodePubKey(pk))
+}
+
+type EncodeNSec struct{}
+
+func (e *EncodeNSec) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	key, err := nip19.DecodePrivateKey(args[0])
+	if err != nil {
+		return err
+	}
+	return printEncoded(nip19.EncodePrivateKey(key))
+}
+
+type EncodeNote struct{}
+
+func (e *EncodeNote) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	id, err := nip19.DecodeEventID(args[0])
+	if err != nil {
+		return err
+	}
+	return printEncoded(nip19.EncodeNote(id))
+}
+
+type EncodeNProfile struct {
+	Relays []string `long:"relay" description:"Relay hint, may be repeated"`
+}
+
+func (e *EncodeNProfile) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	pk, err := nip19.DecodePubKey(args[0])
+	if err != nil {
+		return err
+	}
+	return printEncoded(nip19.EncodeProfile(&nip19.ProfilePointer{
+		PubKey: pk,
+		Relays: e.Relays,
+	}))
+}
+
+type EncodeNEvent struct {
+	Relays []string `long:"relay" description:"Relay hint, may be repeated"`
+	Author string   `long:"author" description:"Author public key"`
+	Kind   int64    `long:"kind" description:"Event kind" default:"-1"`
+}
+
+func (e *EncodeNEvent) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	id, err := nip19.DecodeEventID(args[0])
+	if err != nil {
+		return err
+	}
+	p := &nip19.EventPointer{
+		ID:     id,
+		Relays: e.Relays,
+	}
+	if e.Author != "" {
+		p.Author, err = nip19.DecodePubKey(e.Author)
+		if err != nil {
+			return err
+		}
+	}
+	if e.Kind >= 0 {
+		p.Kind = &e.Kind
+	}
+	return printEncoded(nip19.EncodeEvent(p))
+}
+
+type EncodeNAddr struct {
+	Relays     []string `long:"relay" description:"Relay hint, may be repeated"`
+	PubKey     string   `long:"pubkey" description:"Author public key" required:"true"`
+	Kind       int64    `long:"kind" description:"Event kind" required:"true"`
+	Identifier string   `long:"identifier" description:"d tag of the event"`
+}
+
+func (e *EncodeNAddr) Execute(args []string) error {
+	pk, err := nip19.DecodePubKey(e.PubKey)
+	if err != nil {
+		return err
+	}
+	return printEncoded(nip19.EncodeAddr(&nip19.EntityPointer{
+		Identifier: e.Identifier,
+		PubKey:     pk,
+		Kind:       e.Kind,
+		Relays:     e.Relays,
+	}))
+}
+
+type EncodeNRelay struct{}
+
+func (e *EncodeNRelay) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	return printEncoded(nip19.EncodeRelay(args[0]))
+}
+
+func printEncoded(s string, err error) error {
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
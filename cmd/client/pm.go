@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip17"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/proto/nip59"
+)
+
+type PMSend struct {
+	To      []string `long:"to" description:"Recipient public key (hex, npub or nprofile), may be repeated" required:"true"`
+	Content string   `long:"content" description:"Message" required:"true"`
+}
+
+func (p *PMSend) Execute(args []string) error {
+	ctx := context.Background()
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(ctx)
+	if err != nil {
+		return err
+	}
+	var to []string
+	for _, r := range p.To {
+		pk, err := nip19.DecodePubKey(r)
+		if err != nil {
+			return err
+		}
+		to = append(to, pk)
+	}
+	me, err := sig.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	wraps, err := nip17.Wrap(ctx, sig, nip17.NewMessage(me, to, p.Content))
+	if err != nil {
+		return err
+	}
+
+	c, err := client.Dial(context.Background(), cfg.Relay)
+	if err != nil {
+		return err
+	}
+	inboxes, err := lookupInboxRelays(c, append(to, me))
+	if err != nil {
+		return err
+	}
+	conns := map[string]*client.Client{cfg.Relay: c}
+	for _, w := range wraps {
+		recipient, _ := nip59.Recipient(w)
+		relays := inboxes[recipient]
+		if len(relays) == 0 {
+			relays = []string{cfg.Relay}
+		}
+		for _, r := range relays {
+			rc, ok := conns[r]
+			if !ok {
+				rc, err = client.Dial(context.Background(), r)
+				if err != nil {
+					fmt.Printf("Failed to connect to %s: %v\n", r, err)
+					continue
+				}
+				conns[r] = rc
+			}
+			err = rc.Publish(context.Background(), w)
+			if err != nil {
+				fmt.Printf("Failed to publish to %s: %v\n", r, err)
+				continue
+			}
+			fmt.Printf("Sent wrap %s for %s to %s\n", w.ID, recipient, r)
+		}
+	}
+	return nil
+}
+
+// lookupInboxRelays fetches the kind 10050 relay lists of pubKeys.
+func lookupInboxRelays(c *client.Client, pubKeys []string) (map[string][]string, error) {
+	sub, err := c.Subscribe(context.Background(), &comm.Filter{
+		Kinds:   []int64{nip17.KindInboxRelays},
+		Authors: pubKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+	latest := map[string]*proto.Event{}
+	for _, e := range collectBackfill(sub, 5*time.Second) {
+		if l, ok := latest[e.PubKey]; !ok || e.CreatedAt > l.CreatedAt {
+			latest[e.PubKey] = e
+		}
+	}
+	ret := map[string][]string{}
+	for pk, e := range latest {
+		ret[pk] = nip17.InboxRelays(e)
+	}
+	return ret, nil
+}
+
+type PMList struct {
+	With  string `long:"with" description:"Only show messages with this public key"`
+	Limit int64  `long:"limit" description:"Maximum number of gift wraps to fetch" default:"500"`
+}
+
+func (p *PMList) Execute(args []string) error {
+	ctx := context.Background()
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(ctx)
+	if err != nil {
+		return err
+	}
+	with := ""
+	if p.With != "" {
+		with, err = nip19.DecodePubKey(p.With)
+		if err != nil {
+			return err
+		}
+	}
+	me, err := sig.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	c, err := client.Dial(ctx, cfg.Relay)
+	if err != nil {
+		return err
+	}
+	authCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = c.Auth(authCtx, sig)
+	if err != nil {
+		return err
+	}
+	sub, err := c.Subscribe(context.Background(), &comm.Filter{
+		Kinds:      []int64{nip59.KindGiftWrap},
+		TagFilters: map[string][]string{"p": {me}},
+		Limit:      p.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	var msgs []*proto.Event
+	seen := map[string]bool{}
+	for _, w := range collectBackfill(sub, 10*time.Second) {
+		msg, err := nip17.Open(ctx, sig, w)
+		if err != nil || seen[msg.ID] {
+			continue
+		}
+		seen[msg.ID] = true
+		if with != "" && msg.PubKey != with && !(msg.PubKey == me && contains(nip17.Recipients(msg), with)) {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt < msgs[j].CreatedAt
+	})
+	for _, m := range msgs {
+		fmt.Printf("%s %s -> %s: %s\n",
+			time.Unix(m.CreatedAt, 0).Format(time.RFC3339),
+			shortKey(m.PubKey, me),
+			strings.Join(mapKeys(nip17.Recipients(m), me), ","),
+			m.Content)
+	}
+	return nil
+}
+
+type PMInbox struct {
+	Relays []string `long:"relay" description:"Relay to receive private messages on, may be repeated" required:"true"`
+}
+
+func (p *PMInbox) Execute(args []string) error {
+	ctx := context.Background()
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(ctx)
+	if err != nil {
+		return err
+	}
+	event := nip17.NewInboxRelays(p.Relays)
+	err = sig.SignEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	c, err := client.Dial(ctx, cfg.Relay)
+	if err != nil {
+		return err
+	}
+	return c.Publish(context.Background(), event)
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func shortKey(pk, me string) string {
+	if pk == me {
+		return "me"
+	}
+	npub, err := nip19.EncodePubKey(pk)
+	if err != nil {
+		return pk
+	}
+	return npub
+}
+
+func mapKeys(pks []string, me string) []string {
+	ret := make([]string, len(pks))
+	for i, pk := range pks {
+		ret[i] = shortKey(pk, me)
+	}
+	return ret
+}
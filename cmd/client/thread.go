@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip10"
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/andyleap/nostr/proto/nip21"
+)
+
+var errEventNotFound = errors.New("event not found")
+
+// fetchEvent gets a single event by id (hex, note or nevent).
+func fetchEvent(c *client.Client, id string) (*proto.Event, error) {
+	id, err := nip19.DecodeEventID(id)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := c.Subscribe(context.Background(), &comm.Filter{IDs: []string{id}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+	for _, e := range collectBackfill(sub, 10*time.Second) {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, errEventNotFound
+}
+
+type Reply struct {
+	To      string `long:"to" description:"Event to reply to (hex, note or nevent)" required:"true"`
+	Content string `long:"content" description:"Content" required:"true"`
+}
+
+func (r *Reply) Execute(args []string) error {
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	sig, err := cfg.getSigner(context.Background())
+	if err != nil {
+		return err
+	}
+	c, err := client.Dial(context.Background(), cfg.Relay)
+	if err != nil {
+		return err
+	}
+	parent, err := fetchEvent(c, r.To)
+	if err != nil {
+		return err
+	}
+	event := nip10.NewReply(parent, cfg.Relay, r.Content)
+	nip21.AddTags(event)
+	cfg.delegate(event)
+	err = sig.SignEvent(context.Background(), event)
+	if err != nil {
+		return err
+	}
+	buf, _ := json.Marshal(event)
+	fmt.Printf("%s\n", buf)
+	return c.Publish(context.Background(), event)
+}
+
+type Thread struct{}
+
+func (t *Thread) Execute(args []string) error {
+	if len(args) != 1 {
+		return errNoArg
+	}
+	cfg := loadJSONConfig(CLI.ConfigFile)
+	if cfg.Relay == "" {
+		return errors.New("no relay in config")
+	}
+	c, err := client.Dial(context.Background(), cfg.Relay)
+	if err != nil {
+		return err
+	}
+	e, err := fetchEvent(c, args[0])
+	if err != nil {
+		return err
+	}
+	root := e.ID
+	if r := nip10.Parse(e).Root; r != nil {
+		root = r.ID
+	}
+	sub, err := c.Subscribe(context.Background(),
+		&comm.Filter{IDs: []string{root}, Limit: 1},
+		&comm.Filter{Kinds: []int64{1}, TagFilters: map[string][]string{"e": {root}}, Limit: 1000},
+	)
+	if err != nil {
+		return err
+	}
+	events := append(collectBackfill(sub, 10*time.Second), e)
+	sub.Close()
+
+	nip10.Walk(nip10.BuildThread(events), func(n *nip10.Node, depth int) {
+		indent := strings.Repeat("  ", depth)
+		ts := time.Unix(n.Event.CreatedAt, 0).Format(time.DateTime)
+		fmt.Printf("%s%s %s %s\n", indent, ts, n.Event.ID[:8], shortKey(n.Event.PubKey, ""))
+		for _, line := range strings.Split(n.Event.Content, "\n") {
+			fmt.Printf("%s  %s\n", indent, line)
+		}
+	})
+	return nil
+}
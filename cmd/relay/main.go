@@ -1,17 +1,37 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip05"
 	"github.com/andyleap/nostr/relay"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/logstore"
 	"github.com/andyleap/nostr/relay/eventstore/postgres"
+	"github.com/andyleap/nostr/relay/eventstore/sqlite"
+	"github.com/andyleap/nostr/relay/nips/nip59"
 )
 
-func main() {
+// openStore uses the log store if LOGSTORE_DIR is set, SQLite if
+// SQLITE_PATH is, and Postgres otherwise. PG_MAX_OPEN_CONNS,
+// PG_MAX_IDLE_CONNS, PG_BATCH_SIZE, PG_FLUSH_INTERVAL and PG_QUERY_TIMEOUT
+// tune the Postgres store; a malformed value stops the relay starting.
+func openStore() (eventstore.EventStore, error) {
+	if dir := os.Getenv("LOGSTORE_DIR"); dir != "" {
+		return logstore.New(dir)
+	}
+	if path := os.Getenv("SQLITE_PATH"); path != "" {
+		return sqlite.New(path)
+	}
+
 	pgHost := os.Getenv("PG_HOST")
 	pgUser := os.Getenv("PG_USER")
 	pgPass := os.Getenv("PG_PASS")
@@ -19,7 +39,50 @@ func main() {
 
 	pgConnString := fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable", pgHost, pgUser, pgDB, pgPass)
 
-	store, err := postgres.New(pgConnString)
+	var cfg postgres.Config
+	var errs []error
+	cfg.MaxOpenConns, errs = envInt(errs, "PG_MAX_OPEN_CONNS")
+	cfg.MaxIdleConns, errs = envInt(errs, "PG_MAX_IDLE_CONNS")
+	cfg.BatchSize, errs = envInt(errs, "PG_BATCH_SIZE")
+	cfg.FlushInterval, errs = envDuration(errs, "PG_FLUSH_INTERVAL")
+	cfg.QueryTimeout, errs = envDuration(errs, "PG_QUERY_TIMEOUT")
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return postgres.NewWithConfig(pgConnString, cfg)
+}
+
+// envInt reads an integer setting, zero if it isn't set, appending to
+// errs if it is malformed.
+func envInt(errs []error, name string) (int, []error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, errs
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return n, errs
+}
+
+// envDuration reads a duration setting such as "10ms", zero if it isn't
+// set, appending to errs if it is malformed.
+func envDuration(errs []error, name string) (time.Duration, []error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, errs
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return d, errs
+}
+
+func main() {
+	store, err := openStore()
 	if err != nil {
 		panic(err)
 	}
@@ -30,13 +93,46 @@ func main() {
 	relay := relay.New(store)
 
 	relay.AddFilter(func(e *proto.Event) bool {
+		author := e.Author()
 		for _, k := range pubKeys {
-			if e.PubKey == k {
+			if author == k {
 				return true
 			}
 		}
+		// gift wraps and remote signer requests are signed by keys we
+		// don't know, so accept them when they're addressed to one of our
+		// users instead
+		if e.Kind == 1059 || e.Kind == 24133 {
+			for _, t := range e.Tags {
+				if len(t) < 2 || t[0] != "p" {
+					continue
+				}
+				for _, k := range pubKeys {
+					if t[1] == k {
+						return true
+					}
+				}
+			}
+		}
 		return false
 	})
+	nip59.Attach(relay)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", relay)
+
+	if nip05File := os.Getenv("NIP05_FILE"); nip05File != "" {
+		buf, err := os.ReadFile(nip05File)
+		if err != nil {
+			panic(err)
+		}
+		var doc nip05.Document
+		err = json.Unmarshal(buf, &doc)
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle(nip05.WellKnownPath, nip05.NewHandler(doc))
+	}
 
-	http.ListenAndServe(":8080", relay)
+	http.ListenAndServe(":8080", mux)
 }
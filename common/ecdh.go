@@ -0,0 +1,30 @@
+package common
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+var ErrInvalidPubKey = errors.New("invalid public key")
+
+// ParsePubKeyHex parses an x-only hex public key as used in events,
+// assuming an even y coordinate.
+func ParsePubKeyHex(pubKey string) (*secp256k1.PublicKey, error) {
+	b, err := hex.DecodeString(pubKey)
+	if err != nil || len(b) != 32 {
+		return nil, ErrInvalidPubKey
+	}
+	key, err := secp256k1.ParsePubKey(append([]byte{2}, b...))
+	if err != nil {
+		return nil, ErrInvalidPubKey
+	}
+	return key, nil
+}
+
+// SharedSecret returns the unhashed x coordinate of the ECDH point between
+// key and pubKey, which is what NIP-04 and NIP-44 build on.
+func SharedSecret(key *secp256k1.PrivateKey, pubKey *secp256k1.PublicKey) []byte {
+	return secp256k1.GenerateSharedSecret(key, pubKey)
+}
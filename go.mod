@@ -7,6 +7,10 @@ require (
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/jessevdk/go-flags v1.5.0
 	github.com/lib/pq v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.17
+	golang.org/x/crypto v0.14.0
+	golang.org/x/term v0.13.0
+	golang.org/x/text v0.13.0
 	nhooyr.io/websocket v1.8.7
 )
 
@@ -14,5 +18,5 @@ require (
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
 	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
 	github.com/klauspost/compress v1.10.3 // indirect
-	golang.org/x/sys v0.0.0-20210320140829-1e4c9ba3b0c4 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -3,7 +3,6 @@ package proto
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 
 	"github.com/andyleap/nostr/common"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
@@ -21,16 +20,7 @@ type Event struct {
 }
 
 func (e *Event) CalcID() string {
-	sigobj := []interface{}{
-		0,
-		e.PubKey,
-		e.CreatedAt,
-		e.Kind,
-		e.Tags,
-		e.Content,
-	}
-	buf, _ := json.Marshal(sigobj)
-	hash := sha256.Sum256(buf)
+	hash := sha256.Sum256(e.Serialize())
 	return hex.EncodeToString(hash[:])
 }
 
@@ -42,31 +32,7 @@ func must[t any](v t, err error) t {
 }
 
 func (e *Event) CheckSig() bool {
-	id := e.CalcID()
-	if id != e.ID {
-		return false
-	}
-	k, err := hex.DecodeString(e.PubKey)
-	if err != nil {
-		return false
-	}
-	key, err := schnorr.ParsePubKey(k)
-	if err != nil {
-		return false
-	}
-	s, err := hex.DecodeString(e.Sig)
-	if err != nil {
-		return false
-	}
-	sig, err := schnorr.ParseSignature(s)
-	if err != nil {
-		return false
-	}
-	h, err := hex.DecodeString(id)
-	if err != nil {
-		return false
-	}
-	return sig.Verify(h, key)
+	return e.Validate() == nil
 }
 
 func (e *Event) Sign(key *secp256k1.PrivateKey) error {
@@ -63,6 +63,20 @@ func (c *Close) MarshalJSON() ([]byte, error) {
 	return json.Marshal(msg)
 }
 
+type Auth struct {
+	Event *proto.Event
+}
+
+func (a *Auth) req() {}
+
+func (a *Auth) MarshalJSON() ([]byte, error) {
+	msg := []interface{}{
+		"AUTH",
+		a.Event,
+	}
+	return json.Marshal(msg)
+}
+
 func ParseReq(data []byte) (Req, error) {
 	dec := json.NewDecoder(bytes.NewReader(data))
 	start, err := dec.Token()
@@ -108,6 +122,13 @@ func ParseReq(data []byte) (Req, error) {
 			return nil, err
 		}
 		req = c
+	case "AUTH":
+		a := &Auth{}
+		err = dec.Decode(&a.Event)
+		if err != nil {
+			return nil, err
+		}
+		req = a
 	default:
 		return nil, ErrInvalidComm
 	}
@@ -163,6 +184,38 @@ func (n *Notice) MarshalJSON() ([]byte, error) {
 	return json.Marshal(msg)
 }
 
+type OK struct {
+	ID       string
+	Accepted bool
+	Msg      string
+}
+
+func (o *OK) resp() {}
+
+func (o *OK) MarshalJSON() ([]byte, error) {
+	msg := []interface{}{
+		"OK",
+		o.ID,
+		o.Accepted,
+		o.Msg,
+	}
+	return json.Marshal(msg)
+}
+
+type AuthChallenge struct {
+	Challenge string
+}
+
+func (a *AuthChallenge) resp() {}
+
+func (a *AuthChallenge) MarshalJSON() ([]byte, error) {
+	msg := []interface{}{
+		"AUTH",
+		a.Challenge,
+	}
+	return json.Marshal(msg)
+}
+
 func ParseResp(data []byte) (Resp, error) {
 	dec := json.NewDecoder(bytes.NewReader(data))
 	start, err := dec.Token()
@@ -204,6 +257,28 @@ func ParseResp(data []byte) (Resp, error) {
 			return nil, err
 		}
 		resp = n
+	case "OK":
+		o := &OK{}
+		err = dec.Decode(&o.ID)
+		if err != nil {
+			return nil, err
+		}
+		err = dec.Decode(&o.Accepted)
+		if err != nil {
+			return nil, err
+		}
+		err = dec.Decode(&o.Msg)
+		if err != nil {
+			return nil, err
+		}
+		resp = o
+	case "AUTH":
+		a := &AuthChallenge{}
+		err = dec.Decode(&a.Challenge)
+		if err != nil {
+			return nil, err
+		}
+		resp = a
 	default:
 		return nil, ErrInvalidComm
 	}
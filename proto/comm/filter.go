@@ -2,6 +2,7 @@ package comm
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/andyleap/nostr/proto"
 )
@@ -13,6 +14,9 @@ type Filter struct {
 	Since   int64
 	Until   int64
 	Limit   int64
+	// Search is a NIP-50 full text query. Stores without a search index
+	// match events whose content contains every term, ignoring case.
+	Search string
 
 	TagFilters map[string][]string
 }
@@ -37,6 +41,9 @@ func (f *Filter) MarshalJSON() ([]byte, error) {
 	if f.Limit > 0 {
 		msg["limit"] = f.Limit
 	}
+	if f.Search != "" {
+		msg["search"] = f.Search
+	}
 	for k, v := range f.TagFilters {
 		msg["#"+k] = v
 	}
@@ -64,6 +71,8 @@ func (f *Filter) UnmarshalJSON(data []byte) error {
 			json.Unmarshal(*v, &f.Until)
 		case "limit":
 			json.Unmarshal(*v, &f.Limit)
+		case "search":
+			json.Unmarshal(*v, &f.Search)
 		default:
 			if k[0] == '#' {
 				var vs []string
@@ -75,12 +84,34 @@ func (f *Filter) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// delegator returns the delegator named by e's delegation tag, without
+// checking it.
+func delegator(e *proto.Event) string {
+	for _, t := range e.Tags {
+		if len(t) > 0 && t[0] == proto.TagDelegation {
+			if len(t) < 2 {
+				return ""
+			}
+			return t[1]
+		}
+	}
+	return ""
+}
+
 func (f *Filter) Match(e *proto.Event) bool {
 	if len(f.IDs) > 0 && !contains(f.IDs, e.ID) {
 		return false
 	}
 	if len(f.Authors) > 0 && !contains(f.Authors, e.PubKey) {
-		return false
+		// delegated events also match their delegator. Most don't name
+		// one of the authors, and needn't have their token verified.
+		if !contains(f.Authors, delegator(e)) {
+			return false
+		}
+		d, err := e.CheckDelegation()
+		if err != nil || !contains(f.Authors, d) {
+			return false
+		}
 	}
 	if len(f.Kinds) > 0 && !contains(f.Kinds, e.Kind) {
 		return false
@@ -91,11 +122,19 @@ func (f *Filter) Match(e *proto.Event) bool {
 	if f.Until > 0 && e.CreatedAt > f.Until {
 		return false
 	}
+	if f.Search != "" {
+		content := strings.ToLower(e.Content)
+		for _, term := range SearchTerms(f.Search) {
+			if !strings.Contains(content, term) {
+				return false
+			}
+		}
+	}
 	if len(f.TagFilters) > 0 {
 		for k, v := range f.TagFilters {
 			match := false
 			for _, t := range e.Tags {
-				if t[0] == k && !contains(v, t[1]) {
+				if len(t) >= 2 && t[0] == k && contains(v, t[1]) {
 					match = true
 					break
 				}
@@ -109,6 +148,19 @@ func (f *Filter) Match(e *proto.Event) bool {
 	return true
 }
 
+// SearchTerms splits a search query into lowercased terms, dropping the
+// key:value extensions NIP-50 allows, which aren't supported.
+func SearchTerms(search string) []string {
+	var terms []string
+	for _, term := range strings.Fields(strings.ToLower(search)) {
+		if strings.Contains(term, ":") {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
 func contains[t comparable](s []t, e t) bool {
 	for _, a := range s {
 		if a == e {
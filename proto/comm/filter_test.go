@@ -0,0 +1,30 @@
+package comm
+
+import (
+	"testing"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+func TestMatchTags(t *testing.T) {
+	e := &proto.Event{
+		Kind: 1,
+		Tags: [][]string{{"e", "a"}, {"p", "b"}},
+	}
+	for _, v := range []struct {
+		tags  map[string][]string
+		match bool
+	}{
+		{map[string][]string{"e": {"a"}}, true},
+		{map[string][]string{"e": {"x", "a"}}, true},
+		{map[string][]string{"e": {"x"}}, false},
+		{map[string][]string{"e": {"a"}, "p": {"b"}}, true},
+		{map[string][]string{"e": {"a"}, "p": {"a"}}, false},
+		{map[string][]string{"t": {"a"}}, false},
+	} {
+		f := &Filter{TagFilters: v.tags}
+		if f.Match(e) != v.match {
+			t.Errorf("%v: got %v, want %v", v.tags, !v.match, v.match)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// TagDelegation is the tag NIP-26 delegated events carry:
+// ["delegation", <delegator pubkey>, <conditions>, <token>].
+const TagDelegation = "delegation"
+
+var (
+	ErrNoDelegation         = errors.New("event is not delegated")
+	ErrInvalidConditions    = errors.New("invalid delegation conditions")
+	ErrInvalidDelegation    = errors.New("invalid delegation token")
+	ErrDelegationConditions = errors.New("event does not meet delegation conditions")
+)
+
+// Conditions restricts what a delegatee may sign. An event must have one
+// of Kinds (any kind if empty) and a created_at strictly between After
+// and Before (unbounded if zero).
+type Conditions struct {
+	Kinds  []int64
+	After  int64
+	Before int64
+}
+
+func ParseConditions(s string) (*Conditions, error) {
+	c := &Conditions{}
+	if s == "" {
+		return c, nil
+	}
+	for _, cond := range strings.Split(s, "&") {
+		var field, op, value string
+		if i := strings.IndexAny(cond, "=<>"); i > 0 {
+			field, op, value = cond[:i], cond[i:i+1], cond[i+1:]
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidConditions
+		}
+		switch {
+		case field == "kind" && op == "=":
+			c.Kinds = append(c.Kinds, n)
+		case field == "created_at" && op == ">":
+			if n > c.After {
+				c.After = n
+			}
+		case field == "created_at" && op == "<":
+			if c.Before == 0 || n < c.Before {
+				c.Before = n
+			}
+		default:
+			return nil, ErrInvalidConditions
+		}
+	}
+	return c, nil
+}
+
+func (c *Conditions) String() string {
+	var conds []string
+	for _, k := range c.Kinds {
+		conds = append(conds, "kind="+strconv.FormatInt(k, 10))
+	}
+	if c.After != 0 {
+		conds = append(conds, "created_at>"+strconv.FormatInt(c.After, 10))
+	}
+	if c.Before != 0 {
+		conds = append(conds, "created_at<"+strconv.FormatInt(c.Before, 10))
+	}
+	return strings.Join(conds, "&")
+}
+
+func (c *Conditions) Allows(kind, createdAt int64) bool {
+	if len(c.Kinds) > 0 {
+		found := false
+		for _, k := range c.Kinds {
+			if k == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.After != 0 && createdAt <= c.After {
+		return false
+	}
+	if c.Before != 0 && createdAt >= c.Before {
+		return false
+	}
+	return true
+}
+
+func delegationHash(delegatee, conditions string) []byte {
+	h := sha256.Sum256([]byte("nostr:delegation:" + delegatee + ":" + conditions))
+	return h[:]
+}
+
+// NewDelegation signs a delegation from key to the delegatee pubkey and
+// returns the tag the delegatee adds to its events.
+func NewDelegation(key *secp256k1.PrivateKey, delegatee string, c *Conditions) ([]string, error) {
+	conditions := c.String()
+	sig, err := schnorr.Sign(key, delegationHash(delegatee, conditions))
+	if err != nil {
+		return nil, err
+	}
+	pk := hex.EncodeToString(key.PubKey().SerializeCompressed()[1:])
+	return []string{TagDelegation, pk, conditions, hex.EncodeToString(sig.Serialize())}, nil
+}
+
+// SetDelegation adds a delegation tag, replacing any already present. It
+// must be called before the event is signed.
+func (e *Event) SetDelegation(tag []string) {
+	tags := [][]string{}
+	for _, t := range e.Tags {
+		if len(t) == 0 || t[0] != TagDelegation {
+			tags = append(tags, t)
+		}
+	}
+	e.Tags = append(tags, tag)
+}
+
+// CheckDelegation verifies the event's delegation tag and returns the
+// delegator. It doesn't check the event's own signature.
+func (e *Event) CheckDelegation() (string, error) {
+	var tag []string
+	for _, t := range e.Tags {
+		if len(t) > 0 && t[0] == TagDelegation {
+			tag = t
+			break
+		}
+	}
+	if tag == nil {
+		return "", ErrNoDelegation
+	}
+	if len(tag) < 4 {
+		return "", ErrInvalidDelegation
+	}
+	c, err := ParseConditions(tag[2])
+	if err != nil {
+		return "", err
+	}
+	if !c.Allows(e.Kind, e.CreatedAt) {
+		return "", ErrDelegationConditions
+	}
+	if !checkToken(e.PubKey, tag) {
+		return "", ErrInvalidDelegation
+	}
+	return tag[1], nil
+}
+
+// maxCachedTokens bounds the cache of checked delegation tokens, which is
+// reset when it fills.
+const maxCachedTokens = 10000
+
+// tokens caches checkToken's results, since a delegatee signs many events
+// with the same token and filters check it on every match.
+var tokens = struct {
+	sync.Mutex
+	valid map[string]bool
+}{valid: map[string]bool{}}
+
+// checkToken verifies the signature of a delegation tag for delegatee.
+func checkToken(delegatee string, tag []string) bool {
+	key := delegatee + ":" + tag[1] + ":" + tag[2] + ":" + tag[3]
+	tokens.Lock()
+	valid, ok := tokens.valid[key]
+	tokens.Unlock()
+	if ok {
+		return valid
+	}
+	valid = verifyToken(delegatee, tag)
+	tokens.Lock()
+	if len(tokens.valid) >= maxCachedTokens {
+		tokens.valid = map[string]bool{}
+	}
+	tokens.valid[key] = valid
+	tokens.Unlock()
+	return valid
+}
+
+func verifyToken(delegatee string, tag []string) bool {
+	pkBuf, err := hex.DecodeString(tag[1])
+	if err != nil || len(pkBuf) != 32 {
+		return false
+	}
+	key, err := schnorr.ParsePubKey(pkBuf)
+	if err != nil {
+		return false
+	}
+	sigBuf, err := hex.DecodeString(tag[3])
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBuf)
+	return err == nil && sig.Verify(delegationHash(delegatee, tag[2]), key)
+}
+
+// Author returns the delegator if the event carries a valid delegation,
+// and the event's pubkey otherwise.
+func (e *Event) Author() string {
+	if d, err := e.CheckDelegation(); err == nil {
+		return d
+	}
+	return e.PubKey
+}
@@ -0,0 +1,98 @@
+package proto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	delegatorKey = "ee35e8bb71131c02c1d7e73231daa48e9953d329a4b701f7133c8f46dd21139c"
+	delegatorPub = "8e0d3d3eb2881ec137a11debe736a9086715a8c8beeeda615780064d68bc25dd"
+	delegateeKey = "777e4f60b4aa87937e13acc84f7abcc3c93cc035cb4c1e9f7a9086dd78fffce1"
+	delegateePub = "477318cfb5427b9cfc66a9fa376150c1ddbc62115ae27cef72417eb959691396"
+)
+
+func TestDelegationVector(t *testing.T) {
+	e := &Event{
+		PubKey:    delegateePub,
+		Kind:      1,
+		CreatedAt: 1677000000,
+		Tags: [][]string{{
+			TagDelegation,
+			delegatorPub,
+			"kind=1&created_at>1674834236&created_at<1677426236",
+			"6f44d7fe4f1c09f3954640fb58bd12bae8bb8ff4120853c4693106c82e920e2b898f1f9ba9bd65449a987c39c0423426ab7b53910c0c6abfb41b30bc16e5f524",
+		}},
+	}
+	d, err := e.CheckDelegation()
+	if err != nil || d != delegatorPub {
+		t.Fatal(d, err)
+	}
+	e.Kind = 0
+	if _, err := e.CheckDelegation(); err != ErrDelegationConditions {
+		t.Fatal(err)
+	}
+	e.Kind = 1
+	e.CreatedAt = 1677426236
+	if _, err := e.CheckDelegation(); err != ErrDelegationConditions {
+		t.Fatal(err)
+	}
+	if e.Author() != e.PubKey {
+		t.Fatal("author of out of range event should be the delegatee")
+	}
+}
+
+func TestNewDelegation(t *testing.T) {
+	buf, _ := hex.DecodeString(delegatorKey)
+	delegator := secp256k1.PrivKeyFromBytes(buf)
+	buf, _ = hex.DecodeString(delegateeKey)
+	delegatee := secp256k1.PrivKeyFromBytes(buf)
+
+	tag, err := NewDelegation(delegator, delegateePub, &Conditions{Kinds: []int64{1, 7}, After: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag[1] != delegatorPub || tag[2] != "kind=1&kind=7&created_at>1000" {
+		t.Fatal(tag)
+	}
+	e := &Event{Kind: 7, CreatedAt: 2000, Tags: [][]string{{"e", "x"}}}
+	e.SetDelegation(tag)
+	e.Sign(delegatee)
+	if !e.CheckSig() || e.Author() != delegatorPub {
+		t.Fatal("delegated event not attributed to delegator")
+	}
+
+	// a token for one delegatee can't be reused by another
+	other := &Event{Kind: 7, CreatedAt: 2000, Tags: [][]string{tag}}
+	other.Sign(delegator)
+	if _, err := other.CheckDelegation(); err != ErrInvalidDelegation {
+		t.Fatal(err)
+	}
+
+	// nor be trusted once its signature is changed, cached or not
+	forged := append([]string{}, tag...)
+	forged[3] = strings.Repeat("0", len(tag[3]))
+	e.SetDelegation(forged)
+	e.Sign(delegatee)
+	if _, err := e.CheckDelegation(); err != ErrInvalidDelegation {
+		t.Fatal(err)
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	c, err := ParseConditions("kind=0&kind=1&created_at<200&created_at>100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Allows(0, 150) || !c.Allows(1, 101) || c.Allows(2, 150) || c.Allows(1, 100) || c.Allows(1, 200) {
+		t.Fatal(c)
+	}
+	for _, bad := range []string{"kind>1", "pubkey=abc", "kind=x", "&"} {
+		if _, err := ParseConditions(bad); err != ErrInvalidConditions {
+			t.Error(bad, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package kinds
+
+import (
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+type Contact struct {
+	PubKey  string
+	Relay   string
+	Petname string
+}
+
+// Contacts is a kind 3 follow list. Content is kept as is; some clients
+// still store their relay list there.
+type Contacts struct {
+	Contacts []Contact
+	Content  string
+}
+
+func ParseContacts(e *proto.Event) (*Contacts, error) {
+	if e.Kind != KindContacts {
+		return nil, ErrWrongKind
+	}
+	c := &Contacts{Content: e.Content}
+	for _, t := range e.Tags {
+		if len(t) < 2 || t[0] != "p" {
+			continue
+		}
+		c.Contacts = append(c.Contacts, Contact{
+			PubKey:  t[1],
+			Relay:   tagAt(t, 2),
+			Petname: tagAt(t, 3),
+		})
+	}
+	return c, nil
+}
+
+func (c *Contacts) Event() *proto.Event {
+	e := &proto.Event{
+		Kind:      KindContacts,
+		CreatedAt: time.Now().Unix(),
+		Tags:      [][]string{},
+		Content:   c.Content,
+	}
+	for _, ct := range c.Contacts {
+		e.Tags = append(e.Tags, hintTag("p", ct.PubKey, ct.Relay, ct.Petname))
+	}
+	return e
+}
+
+// Find returns the contact for pubKey, or nil.
+func (c *Contacts) Find(pubKey string) *Contact {
+	for i := range c.Contacts {
+		if c.Contacts[i].PubKey == pubKey {
+			return &c.Contacts[i]
+		}
+	}
+	return nil
+}
+
+// Follow adds pubKey, updating its relay hint and petname if it's already
+// followed.
+func (c *Contacts) Follow(ct Contact) {
+	if old := c.Find(ct.PubKey); old != nil {
+		*old = ct
+		return
+	}
+	c.Contacts = append(c.Contacts, ct)
+}
+
+func (c *Contacts) Unfollow(pubKey string) {
+	contacts := c.Contacts[:0]
+	for _, ct := range c.Contacts {
+		if ct.PubKey != pubKey {
+			contacts = append(contacts, ct)
+		}
+	}
+	c.Contacts = contacts
+}
@@ -0,0 +1,63 @@
+// Package kinds has typed wrappers for common event kinds, each with a
+// Parse function reading one from an event and an Event method building
+// an unsigned event from it.
+package kinds
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	KindMetadata      = 0
+	KindNote          = 1
+	KindContacts      = 3
+	KindRepost        = 6
+	KindReaction      = 7
+	KindGenericRepost = 16
+)
+
+var (
+	ErrWrongKind = errors.New("kinds: event has the wrong kind")
+	ErrNoTarget  = errors.New("kinds: event has no target e tag")
+)
+
+// findTag returns the last tag named name, which NIP-25 and NIP-18 say
+// is the target when there are several.
+func findTag(tags [][]string, name string) []string {
+	var ret []string
+	for _, t := range tags {
+		if len(t) >= 2 && t[0] == name {
+			ret = t
+		}
+	}
+	return ret
+}
+
+func tagAt(t []string, i int) string {
+	if i < len(t) {
+		return t[i]
+	}
+	return ""
+}
+
+// kindTag reads a k tag, returning def if there isn't a valid one.
+func kindTag(tags [][]string, def int64) int64 {
+	t := findTag(tags, "k")
+	if t == nil {
+		return def
+	}
+	k, err := strconv.ParseInt(t[1], 10, 64)
+	if err != nil {
+		return def
+	}
+	return k
+}
+
+// hintTag builds a tag, dropping trailing empty values.
+func hintTag(values ...string) []string {
+	for len(values) > 2 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
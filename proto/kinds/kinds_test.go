@@ -0,0 +1,124 @@
+package kinds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+)
+
+func TestMetadata(t *testing.T) {
+	e := &proto.Event{
+		Kind:    KindMetadata,
+		Content: `{"name":"bob","picture":"https://example.com/a.png","nip05":"bob@example.com","lud16":"bob@wallet.example","pronouns":"they/them"}`,
+	}
+	m, err := ParseMetadata(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "bob" || m.NIP05 != "bob@example.com" || m.LUD16 != "bob@wallet.example" {
+		t.Fatal(m)
+	}
+	m.Banner = "https://example.com/b.png"
+	back, err := ParseMetadata(m.Event())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, back) || string(back.Extra["pronouns"]) != `"they/them"` {
+		t.Fatal(m.Event().Content)
+	}
+	if _, err := ParseMetadata(&proto.Event{Kind: KindNote}); err != ErrWrongKind {
+		t.Fatal(err)
+	}
+}
+
+func TestContacts(t *testing.T) {
+	c := &Contacts{}
+	c.Follow(Contact{PubKey: "a", Relay: "wss://r"})
+	c.Follow(Contact{PubKey: "b", Petname: "bob"})
+	c.Follow(Contact{PubKey: "c"})
+	c.Follow(Contact{PubKey: "a", Relay: "wss://r2", Petname: "alice"})
+	c.Unfollow("c")
+
+	e := c.Event()
+	want := [][]string{{"p", "a", "wss://r2", "alice"}, {"p", "b", "", "bob"}}
+	if !reflect.DeepEqual(e.Tags, want) {
+		t.Fatal(e.Tags)
+	}
+	back, err := ParseContacts(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, back) {
+		t.Fatal(back)
+	}
+}
+
+func TestNote(t *testing.T) {
+	n := &Note{
+		Content:  "hello #nostr",
+		Mentions: []string{"a"},
+		Hashtags: []string{"nostr"},
+		Tags:     [][]string{{"subject", "hi"}},
+	}
+	back, err := ParseNote(n.Event())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(n, back) {
+		t.Fatal(back)
+	}
+}
+
+func TestReaction(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	target := &proto.Event{Kind: 30023, Content: "article"}
+	target.Sign(key)
+
+	r := NewReaction(target, "wss://r", "🤙")
+	e := r.Event()
+	back, err := ParseReaction(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, back) || back.Like() {
+		t.Fatal(e.Tags)
+	}
+
+	// reactions without k tags are to notes
+	back, err = ParseReaction(&proto.Event{Kind: KindReaction, Content: "+", Tags: [][]string{{"e", "x"}, {"e", "y"}}})
+	if err != nil || back.EventID != "y" || back.TargetKind != KindNote || !back.Like() {
+		t.Fatal(back, err)
+	}
+	if _, err := ParseReaction(&proto.Event{Kind: KindReaction}); err != ErrNoTarget {
+		t.Fatal(err)
+	}
+}
+
+func TestRepost(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	for _, kind := range []int64{KindNote, 30023} {
+		target := &proto.Event{Kind: kind, Content: "reposted", Tags: [][]string{}}
+		target.Sign(key)
+		r := NewRepost(target, "wss://r")
+		e := r.Event()
+		if (kind == KindNote) != (e.Kind == KindRepost) {
+			t.Fatal(e.Kind)
+		}
+		back, err := ParseRepost(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, back) {
+			t.Fatal(back)
+		}
+	}
+
+	// no empty relay hint
+	target := &proto.Event{Kind: KindNote, Content: "reposted"}
+	target.Sign(key)
+	if tag := NewRepost(target, "").Event().Tags[0]; len(tag) != 2 {
+		t.Fatal(tag)
+	}
+}
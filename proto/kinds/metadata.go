@@ -0,0 +1,88 @@
+package kinds
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+// Metadata is a kind 0 profile. Fields it doesn't know are kept in Extra
+// so that editing a profile doesn't drop what other clients set.
+type Metadata struct {
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	About       string `json:"about,omitempty"`
+	Picture     string `json:"picture,omitempty"`
+	Banner      string `json:"banner,omitempty"`
+	Website     string `json:"website,omitempty"`
+	NIP05       string `json:"nip05,omitempty"`
+	LUD06       string `json:"lud06,omitempty"`
+	LUD16       string `json:"lud16,omitempty"`
+	Bot         bool   `json:"bot,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// metadataFields avoids recursing into Metadata's own marshalling.
+type metadataFields Metadata
+
+var metadataKeys = []string{"name", "display_name", "about", "picture", "banner", "website", "nip05", "lud06", "lud16", "bot"}
+
+func (m *Metadata) MarshalJSON() ([]byte, error) {
+	buf, err := json.Marshal((*metadataFields)(m))
+	if err != nil || len(m.Extra) == 0 {
+		return buf, err
+	}
+	all := map[string]json.RawMessage{}
+	for k, v := range m.Extra {
+		all[k] = v
+	}
+	err = json.Unmarshal(buf, &all)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*metadataFields)(m))
+	if err != nil {
+		return err
+	}
+	all := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return err
+	}
+	for _, k := range metadataKeys {
+		delete(all, k)
+	}
+	m.Extra = nil
+	if len(all) > 0 {
+		m.Extra = all
+	}
+	return nil
+}
+
+func ParseMetadata(e *proto.Event) (*Metadata, error) {
+	if e.Kind != KindMetadata {
+		return nil, ErrWrongKind
+	}
+	m := &Metadata{}
+	err := json.Unmarshal([]byte(e.Content), m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Metadata) Event() *proto.Event {
+	buf, _ := m.MarshalJSON()
+	return &proto.Event{
+		Kind:      KindMetadata,
+		CreatedAt: time.Now().Unix(),
+		Tags:      [][]string{},
+		Content:   string(buf),
+	}
+}
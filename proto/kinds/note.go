@@ -0,0 +1,51 @@
+package kinds
+
+import (
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+// Note is a kind 1 text note. Mentions and Hashtags are its p and t
+// tags; any other tags are kept in Tags.
+type Note struct {
+	Content  string
+	Mentions []string
+	Hashtags []string
+	Tags     [][]string
+}
+
+func ParseNote(e *proto.Event) (*Note, error) {
+	if e.Kind != KindNote {
+		return nil, ErrWrongKind
+	}
+	n := &Note{Content: e.Content}
+	for _, t := range e.Tags {
+		switch {
+		case len(t) == 2 && t[0] == "p":
+			n.Mentions = append(n.Mentions, t[1])
+		case len(t) == 2 && t[0] == "t":
+			n.Hashtags = append(n.Hashtags, t[1])
+		default:
+			n.Tags = append(n.Tags, t)
+		}
+	}
+	return n, nil
+}
+
+func (n *Note) Event() *proto.Event {
+	e := &proto.Event{
+		Kind:      KindNote,
+		CreatedAt: time.Now().Unix(),
+		Tags:      [][]string{},
+		Content:   n.Content,
+	}
+	for _, p := range n.Mentions {
+		e.Tags = append(e.Tags, []string{"p", p})
+	}
+	for _, t := range n.Hashtags {
+		e.Tags = append(e.Tags, []string{"t", t})
+	}
+	e.Tags = append(e.Tags, n.Tags...)
+	return e
+}
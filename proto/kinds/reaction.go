@@ -0,0 +1,74 @@
+package kinds
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+// Reaction is a NIP-25 kind 7 reaction. Content is "+" for a like, "-"
+// for a dislike, or an emoji.
+type Reaction struct {
+	Content string
+
+	EventID    string
+	Relay      string
+	Author     string
+	TargetKind int64
+}
+
+// NewReaction reacts to target, which was seen on relay (optional).
+func NewReaction(target *proto.Event, relay, content string) *Reaction {
+	return &Reaction{
+		Content:    content,
+		EventID:    target.ID,
+		Relay:      relay,
+		Author:     target.PubKey,
+		TargetKind: target.Kind,
+	}
+}
+
+func ParseReaction(e *proto.Event) (*Reaction, error) {
+	if e.Kind != KindReaction {
+		return nil, ErrWrongKind
+	}
+	target := findTag(e.Tags, "e")
+	if target == nil {
+		return nil, ErrNoTarget
+	}
+	r := &Reaction{
+		Content:    e.Content,
+		EventID:    target[1],
+		Relay:      tagAt(target, 2),
+		TargetKind: kindTag(e.Tags, KindNote),
+	}
+	if p := findTag(e.Tags, "p"); p != nil {
+		r.Author = p[1]
+	}
+	return r, nil
+}
+
+func (r *Reaction) Event() *proto.Event {
+	e := &proto.Event{
+		Kind:      KindReaction,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			hintTag("e", r.EventID, r.Relay, r.Author),
+		},
+		Content: r.Content,
+	}
+	if r.Author != "" {
+		e.Tags = append(e.Tags, []string{"p", r.Author})
+	}
+	e.Tags = append(e.Tags, []string{"k", strconv.FormatInt(r.TargetKind, 10)})
+	return e
+}
+
+func (r *Reaction) Like() bool {
+	return r.Content == "+" || r.Content == ""
+}
+
+func (r *Reaction) Dislike() bool {
+	return r.Content == "-"
+}
@@ -0,0 +1,81 @@
+package kinds
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+// Repost is a NIP-18 repost: kind 6 for text notes and kind 16 for
+// anything else. Reposted is the embedded event, if the repost carries
+// one.
+type Repost struct {
+	EventID    string
+	Relay      string
+	Author     string
+	TargetKind int64
+	Reposted   *proto.Event
+}
+
+// NewRepost reposts target, which was seen on relay.
+func NewRepost(target *proto.Event, relay string) *Repost {
+	return &Repost{
+		EventID:    target.ID,
+		Relay:      relay,
+		Author:     target.PubKey,
+		TargetKind: target.Kind,
+		Reposted:   target,
+	}
+}
+
+func ParseRepost(e *proto.Event) (*Repost, error) {
+	if e.Kind != KindRepost && e.Kind != KindGenericRepost {
+		return nil, ErrWrongKind
+	}
+	target := findTag(e.Tags, "e")
+	if target == nil {
+		return nil, ErrNoTarget
+	}
+	r := &Repost{
+		EventID:    target[1],
+		Relay:      tagAt(target, 2),
+		TargetKind: KindNote,
+	}
+	if e.Kind == KindGenericRepost {
+		r.TargetKind = kindTag(e.Tags, 0)
+	}
+	if p := findTag(e.Tags, "p"); p != nil {
+		r.Author = p[1]
+	}
+	if e.Content != "" {
+		reposted := &proto.Event{}
+		if json.Unmarshal([]byte(e.Content), reposted) == nil && reposted.ID == r.EventID {
+			r.Reposted = reposted
+		}
+	}
+	return r, nil
+}
+
+func (r *Repost) Event() *proto.Event {
+	e := &proto.Event{
+		Kind:      KindRepost,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			hintTag("e", r.EventID, r.Relay),
+		},
+	}
+	if r.Author != "" {
+		e.Tags = append(e.Tags, []string{"p", r.Author})
+	}
+	if r.TargetKind != KindNote {
+		e.Kind = KindGenericRepost
+		e.Tags = append(e.Tags, []string{"k", strconv.FormatInt(r.TargetKind, 10)})
+	}
+	if r.Reposted != nil {
+		buf, _ := json.Marshal(r.Reposted)
+		e.Content = string(buf)
+	}
+	return e
+}
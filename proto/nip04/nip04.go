@@ -0,0 +1,153 @@
+// Package nip04 implements the AES-256-CBC encrypted direct messages of
+// NIP-04. New code should prefer NIP-44; this exists for compatibility
+// with the kind 4 messages most clients still send.
+package nip04
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const KindEncryptedDirectMessage = 4
+
+var (
+	ErrInvalidContent = errors.New("invalid nip04 content")
+	ErrInvalidPadding = errors.New("invalid nip04 padding")
+	ErrNoRecipient    = errors.New("direct message has no p tag")
+	ErrNotParticipant = errors.New("key is not a participant in this direct message")
+)
+
+// SharedKey derives the AES key used between key and the hex public key
+// pubKey.
+func SharedKey(key *secp256k1.PrivateKey, pubKey string) ([]byte, error) {
+	pk, err := common.ParsePubKeyHex(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return common.SharedSecret(key, pk), nil
+}
+
+// Encrypt encrypts plaintext with a shared key and returns content in the
+// "<base64 ciphertext>?iv=<base64 iv>" format.
+func Encrypt(sharedKey []byte, plaintext string) (string, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	return encrypt(sharedKey, iv, plaintext)
+}
+
+func encrypt(sharedKey, iv []byte, plaintext string) (string, error) {
+	block, err := aes.NewCipher(sharedKey)
+	if err != nil {
+		return "", err
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	buf := append([]byte(plaintext), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(buf, buf)
+	return base64.StdEncoding.EncodeToString(buf) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(sharedKey []byte, content string) (string, error) {
+	ct, ivStr, ok := strings.Cut(content, "?iv=")
+	if !ok {
+		return "", ErrInvalidContent
+	}
+	buf, err := base64.StdEncoding.DecodeString(ct)
+	if err != nil {
+		return "", ErrInvalidContent
+	}
+	iv, err := base64.StdEncoding.DecodeString(ivStr)
+	if err != nil || len(iv) != aes.BlockSize {
+		return "", ErrInvalidContent
+	}
+	if len(buf) == 0 || len(buf)%aes.BlockSize != 0 {
+		return "", ErrInvalidContent
+	}
+	block, err := aes.NewCipher(sharedKey)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(buf, buf)
+	pad := int(buf[len(buf)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return "", ErrInvalidPadding
+	}
+	for _, b := range buf[len(buf)-pad:] {
+		if int(b) != pad {
+			return "", ErrInvalidPadding
+		}
+	}
+	return string(buf[:len(buf)-pad]), nil
+}
+
+// NewDirectMessage builds an unsigned kind 4 event from key to recipient.
+func NewDirectMessage(key *secp256k1.PrivateKey, recipient string, plaintext string) (*proto.Event, error) {
+	shared, err := SharedKey(key, recipient)
+	if err != nil {
+		return nil, err
+	}
+	content, err := Encrypt(shared, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Event{
+		Kind:      KindEncryptedDirectMessage,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			{"p", recipient},
+		},
+		Content: content,
+	}, nil
+}
+
+// Recipient returns the first p tag of a direct message.
+func Recipient(e *proto.Event) (string, error) {
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == "p" {
+			return t[1], nil
+		}
+	}
+	return "", ErrNoRecipient
+}
+
+// Counterparty returns the pubkey on the other side of a direct message
+// from the point of view of ourPubKey.
+func Counterparty(e *proto.Event, ourPubKey string) (string, error) {
+	recipient, err := Recipient(e)
+	if err != nil {
+		return "", err
+	}
+	switch ourPubKey {
+	case e.PubKey:
+		return recipient, nil
+	case recipient:
+		return e.PubKey, nil
+	}
+	return "", ErrNotParticipant
+}
+
+// DecryptMessage decrypts a direct message that key either sent or
+// received.
+func DecryptMessage(key *secp256k1.PrivateKey, e *proto.Event) (string, error) {
+	other, err := Counterparty(e, common.PubKeyHex(key.PubKey()))
+	if err != nil {
+		return "", err
+	}
+	shared, err := SharedKey(key, other)
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(shared, e.Content)
+}
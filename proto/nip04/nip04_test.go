@@ -0,0 +1,99 @@
+package nip04
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	sk1 = "91ba716fa9e7ea2fcbad360cf4f8e0d312f73984da63d90f524ad61a6a1e7dbe"
+	sk2 = "96f6fa197aa07477ab88f6981118466ae3a982faab8ad5db9d5426870c73d220"
+)
+
+func key(t *testing.T, s string) *secp256k1.PrivateKey {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secp256k1.PrivKeyFromBytes(b)
+}
+
+// The first vector comes from nostr-tools; the others were produced with
+// Node's crypto module (OpenSSL) from the same key pair.
+var vectors = []struct {
+	plaintext string
+	content   string
+	iv        string
+}{
+	{"nanana", "zJxfaJ32rN5Dg1ODjOlEew==?iv=EV5bUjcc4OX2Km/zPp4ndQ==", ""},
+	{"nanana", "DFfILgW/12bQTpr+2pd6oQ==?iv=AAECAwQFBgcICQoLDA0ODw==", "000102030405060708090a0b0c0d0e0f"},
+	{
+		"hello, 世界! <this is a longer message that spans several AES blocks>",
+		"LCD+Cqu4g31bn9XtdWs6xkCvqYb3WxPImKehz9YMZDC9z22AUlUXLXqLMle3FPX3PcPRR10PWquBgny6OZAUiddtHnyFSzDunXhGXVdB/SU=?iv=8OHSw7Sllod4aVpLPC0eDw==",
+		"f0e1d2c3b4a5968778695a4b3c2d1e0f",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	k1, k2 := key(t, sk1), key(t, sk2)
+	s1, err := SharedKey(k1, common.PubKeyHex(k2.PubKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, _ := SharedKey(k2, common.PubKeyHex(k1.PubKey()))
+	if hex.EncodeToString(s1) != "7ce22696eb0e303ddaa491bdf2a56b79d249f2d861b8e012a933e01dc4beba81" || string(s1) != string(s2) {
+		t.Fatal("shared key mismatch", hex.EncodeToString(s1), hex.EncodeToString(s2))
+	}
+	for _, v := range vectors {
+		pt, err := Decrypt(s2, v.content)
+		if err != nil || pt != v.plaintext {
+			t.Errorf("Decrypt(%s) = %q, %v", v.content, pt, err)
+		}
+		if v.iv == "" {
+			continue
+		}
+		iv, _ := hex.DecodeString(v.iv)
+		ct, err := encrypt(s1, iv, v.plaintext)
+		if err != nil || ct != v.content {
+			t.Errorf("encrypt(%q) = %s, %v", v.plaintext, ct, err)
+		}
+	}
+}
+
+func TestDirectMessage(t *testing.T) {
+	k1, k2 := key(t, sk1), key(t, sk2)
+	e, err := NewDirectMessage(k1, common.PubKeyHex(k2.PubKey()), "hi there")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Sign(k1); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []*secp256k1.PrivateKey{k1, k2} {
+		pt, err := DecryptMessage(k, e)
+		if err != nil || pt != "hi there" {
+			t.Fatal(pt, err)
+		}
+	}
+	if _, err := DecryptMessage(common.GeneratePrivateKey(), e); err != ErrNotParticipant {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	shared := make([]byte, 32)
+	for _, c := range []string{
+		"",
+		"zJxfaJ32rN5Dg1ODjOlEew==",
+		"zJxfaJ32rN5Dg1ODjOlEew==?iv=AAEC",
+		"zJxfaJ32rN5Dg1ODjOlE?iv=EV5bUjcc4OX2Km/zPp4ndQ==",
+		"zJxfaJ32rN5Dg1ODjOlEew==?iv=EV5bUjcc4OX2Km/zPp4ndQ==",
+	} {
+		if _, err := Decrypt(shared, c); err == nil {
+			t.Errorf("Decrypt(%q) should fail", c)
+		}
+	}
+}
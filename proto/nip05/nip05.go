@@ -0,0 +1,279 @@
+// Package nip05 maps internet identifiers (name@domain) to public keys as
+// described in NIP-05, both as a caching resolver and as a server side
+// handler for the /.well-known/nostr.json document.
+package nip05
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+const WellKnownPath = "/.well-known/nostr.json"
+
+// maxResponseSize bounds how much of a nostr.json document is read.
+const maxResponseSize = 1 << 20
+
+var (
+	ErrInvalidIdentifier = errors.New("invalid nip05 identifier")
+	ErrNotFound          = errors.New("nip05 name not found")
+	ErrInvalidPubKey     = errors.New("nip05 document has an invalid pubkey")
+	ErrNoIdentifier      = errors.New("metadata has no nip05 identifier")
+	ErrMismatch          = errors.New("nip05 identifier does not match event pubkey")
+	ErrNotMetadata       = errors.New("event is not kind 0 metadata")
+)
+
+// Document is the shape of a nostr.json document.
+type Document struct {
+	Names  map[string]string   `json:"names"`
+	Relays map[string][]string `json:"relays,omitempty"`
+}
+
+// ParseIdentifier splits an identifier into its lowercased local part and
+// domain. A bare domain is treated as _@domain.
+func ParseIdentifier(id string) (string, string, error) {
+	name, domain := "_", id
+	if i := strings.LastIndexByte(id, '@'); i >= 0 {
+		name, domain = id[:i], id[i+1:]
+	}
+	name = strings.ToLower(name)
+	domain = strings.ToLower(domain)
+	if name == "" || domain == "" {
+		return "", "", ErrInvalidIdentifier
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", "", ErrInvalidIdentifier
+		}
+	}
+	if strings.ContainsAny(domain, "/?#@ ") {
+		return "", "", ErrInvalidIdentifier
+	}
+	return name, domain, nil
+}
+
+func validPubKey(pk string) bool {
+	if len(pk) != 64 || strings.ToLower(pk) != pk {
+		return false
+	}
+	_, err := hex.DecodeString(pk)
+	return err == nil
+}
+
+func validRelay(r string) bool {
+	u, err := url.Parse(r)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "wss" || u.Scheme == "ws") && u.Host != ""
+}
+
+type cacheEntry struct {
+	p       *nip19.ProfilePointer
+	err     error
+	expires time.Time
+}
+
+// Resolver looks up identifiers over HTTPS and caches the results,
+// including misses, for TTL.
+type Resolver struct {
+	Client *http.Client
+	TTL    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	now   func() time.Time
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		TTL: time.Hour,
+	}
+}
+
+func (r *Resolver) client() *http.Client {
+	c := *http.DefaultClient
+	if r.Client != nil {
+		c = *r.Client
+	}
+	// NIP-05 fetchers must ignore redirects.
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &c
+}
+
+func (r *Resolver) timeNow() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// Resolve returns the public key and relay hints for identifier.
+func (r *Resolver) Resolve(ctx context.Context, identifier string) (*nip19.ProfilePointer, error) {
+	name, domain, err := ParseIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+	key := name + "@" + domain
+	r.mu.Lock()
+	if ce, ok := r.cache[key]; ok && r.timeNow().Before(ce.expires) {
+		r.mu.Unlock()
+		return ce.p, ce.err
+	}
+	r.mu.Unlock()
+
+	p, err := r.fetch(ctx, name, domain)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrInvalidPubKey) {
+		return nil, err
+	}
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = map[string]cacheEntry{}
+	}
+	r.cache[key] = cacheEntry{
+		p:       p,
+		err:     err,
+		expires: r.timeNow().Add(r.TTL),
+	}
+	r.mu.Unlock()
+	return p, err
+}
+
+func (r *Resolver) fetch(ctx context.Context, name, domain string) (*nip19.ProfilePointer, error) {
+	u := "https://" + domain + WellKnownPath + "?name=" + url.QueryEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nip05: %s returned %s", domain, resp.Status)
+	}
+	var doc Document
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("nip05: invalid document from %s: %w", domain, err)
+	}
+	pk, ok := doc.Names[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !validPubKey(pk) {
+		return nil, ErrInvalidPubKey
+	}
+	p := &nip19.ProfilePointer{PubKey: pk}
+	for _, relay := range doc.Relays[pk] {
+		if validRelay(relay) {
+			p.Relays = append(p.Relays, relay)
+		}
+	}
+	return p, nil
+}
+
+// Verify checks that the nip05 field of a kind 0 event resolves to the
+// event's author.
+func (r *Resolver) Verify(ctx context.Context, e *proto.Event) error {
+	if e.Kind != 0 {
+		return ErrNotMetadata
+	}
+	var md struct {
+		NIP05 string `json:"nip05"`
+	}
+	if err := json.Unmarshal([]byte(e.Content), &md); err != nil {
+		return err
+	}
+	if md.NIP05 == "" {
+		return ErrNoIdentifier
+	}
+	p, err := r.Resolve(ctx, md.NIP05)
+	if err != nil {
+		return err
+	}
+	if p.PubKey != e.PubKey {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Handler serves a nostr.json document. When the request carries a name
+// parameter only that entry and its relays are returned.
+type Handler struct {
+	mu  sync.RWMutex
+	doc Document
+}
+
+func NewHandler(doc Document) *Handler {
+	h := &Handler{}
+	h.Set(doc)
+	return h
+}
+
+// Set replaces the served document. Names are lowercased and entries with
+// invalid pubkeys are dropped.
+func (h *Handler) Set(doc Document) {
+	clean := Document{
+		Names:  map[string]string{},
+		Relays: map[string][]string{},
+	}
+	for name, pk := range doc.Names {
+		if validPubKey(pk) {
+			clean.Names[strings.ToLower(name)] = pk
+		}
+	}
+	for pk, relays := range doc.Relays {
+		clean.Relays[pk] = relays
+	}
+	h.mu.Lock()
+	h.doc = clean
+	h.mu.Unlock()
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	if req.Method == http.MethodOptions {
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.RLock()
+	resp := h.doc
+	if name := req.URL.Query().Get("name"); name != "" {
+		resp = Document{Names: map[string]string{}, Relays: map[string][]string{}}
+		if pk, ok := h.doc.Names[strings.ToLower(name)]; ok {
+			resp.Names[strings.ToLower(name)] = pk
+			if relays, ok := h.doc.Relays[pk]; ok {
+				resp.Relays[pk] = relays
+			}
+		}
+	}
+	buf, _ := json.Marshal(resp)
+	h.mu.RUnlock()
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(buf)
+}
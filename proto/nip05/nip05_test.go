@@ -0,0 +1,118 @@
+package nip05
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+)
+
+func newServer(t *testing.T, h http.Handler) (*Resolver, string, *int32) {
+	var hits int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		h.ServeHTTP(rw, req)
+	}))
+	t.Cleanup(srv.Close)
+	r := NewResolver()
+	r.Client = srv.Client()
+	return r, strings.TrimPrefix(srv.URL, "https://"), &hits
+}
+
+func TestResolve(t *testing.T) {
+	pk := strings.Repeat("ab", 32)
+	h := NewHandler(Document{
+		Names: map[string]string{
+			"Bob": pk,
+			"bad": "nothex",
+		},
+		Relays: map[string][]string{
+			pk: {"wss://relay.example.com", "https://not-a-relay"},
+		},
+	})
+	r, domain, hits := newServer(t, h)
+	ctx := context.Background()
+
+	p, err := r.Resolve(ctx, "bob@"+domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.PubKey != pk || len(p.Relays) != 1 || p.Relays[0] != "wss://relay.example.com" {
+		t.Fatalf("got %+v", p)
+	}
+	if _, err := r.Resolve(ctx, "BOB@"+domain); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 1 {
+		t.Fatalf("expected cached result, got %d requests", *hits)
+	}
+	if _, err := r.Resolve(ctx, "bad@"+domain); err != ErrNotFound {
+		t.Fatal("expected not found for invalid entry, got", err)
+	}
+	if _, err := r.Resolve(ctx, "alice@"+domain); err != ErrNotFound {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	r.now = func() time.Time { return now.Add(2 * r.TTL) }
+	if _, err := r.Resolve(ctx, "bob@"+domain); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 4 {
+		t.Fatalf("expected expired entry to be refetched, got %d requests", *hits)
+	}
+}
+
+func TestResolveRejects(t *testing.T) {
+	r, domain, _ := newServer(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Query().Get("name") {
+		case "redirect":
+			http.Redirect(rw, req, "/elsewhere", http.StatusFound)
+		case "upper":
+			rw.Write([]byte(`{"names":{"upper":"` + strings.Repeat("AB", 32) + `"}}`))
+		default:
+			rw.Write([]byte(`not json`))
+		}
+	}))
+	ctx := context.Background()
+	if _, err := r.Resolve(ctx, "redirect@"+domain); err == nil {
+		t.Fatal("redirect should not be followed")
+	}
+	if _, err := r.Resolve(ctx, "upper@"+domain); err != ErrInvalidPubKey {
+		t.Fatal(err)
+	}
+	if _, err := r.Resolve(ctx, "junk@"+domain); err == nil {
+		t.Fatal("expected error for invalid json")
+	}
+	if _, err := r.Resolve(ctx, "sp ace@"+domain); err != ErrInvalidIdentifier {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	pk := common.PubKeyHex(key.PubKey())
+	h := NewHandler(Document{Names: map[string]string{"_": pk}})
+	r, domain, _ := newServer(t, h)
+
+	e := &proto.Event{Kind: 0, Content: `{"name":"x","nip05":"_@` + domain + `"}`}
+	e.Sign(key)
+	if err := r.Verify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	e.Content = `{"name":"x","nip05":"` + domain + `"}`
+	e.PubKey = strings.Repeat("00", 32)
+	if err := r.Verify(context.Background(), e); err != ErrMismatch {
+		t.Fatal(err)
+	}
+	e.Content = `{"name":"x"}`
+	if err := r.Verify(context.Background(), e); err != ErrNoIdentifier {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,105 @@
+package nip06
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Hardened is added to a child index to derive a hardened child.
+const Hardened uint32 = 0x80000000
+
+var (
+	ErrInvalidPath  = errors.New("bip32: invalid derivation path")
+	ErrInvalidChild = errors.New("bip32: derived key is invalid, try the next index")
+)
+
+// ExtendedKey is a BIP-32 private key with its chain code.
+type ExtendedKey struct {
+	Key       *secp256k1.PrivateKey
+	ChainCode []byte
+}
+
+func split(key, data []byte) (*secp256k1.ModNScalar, []byte, error) {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	var k secp256k1.ModNScalar
+	if k.SetByteSlice(sum[:32]) || k.IsZero() {
+		return nil, nil, ErrInvalidChild
+	}
+	return &k, sum[32:], nil
+}
+
+// NewMaster derives the master key for a seed.
+func NewMaster(seed []byte) (*ExtendedKey, error) {
+	k, chain, err := split([]byte("Bitcoin seed"), seed)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedKey{Key: secp256k1.NewPrivateKey(k), ChainCode: chain}, nil
+}
+
+// Child derives the child key at index, which is hardened if it has the
+// Hardened bit set.
+func (e *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	var data []byte
+	if index >= Hardened {
+		data = append([]byte{0}, e.Key.Serialize()...)
+	} else {
+		data = e.Key.PubKey().SerializeCompressed()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	k, chain, err := split(e.ChainCode, data)
+	if err != nil {
+		return nil, err
+	}
+	k.Add(&e.Key.Key)
+	if k.IsZero() {
+		return nil, ErrInvalidChild
+	}
+	return &ExtendedKey{Key: secp256k1.NewPrivateKey(k), ChainCode: chain}, nil
+}
+
+// ParsePath parses a path like m/44'/1237'/0'/0/0 into child indexes.
+// Both ' and h mark hardened indexes.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, ErrInvalidPath
+	}
+	var ret []uint32
+	for _, p := range parts[1:] {
+		hardened := strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h")
+		if hardened {
+			p = p[:len(p)-1]
+		}
+		i, err := strconv.ParseUint(p, 10, 31)
+		if err != nil {
+			return nil, ErrInvalidPath
+		}
+		idx := uint32(i)
+		if hardened {
+			idx += Hardened
+		}
+		ret = append(ret, idx)
+	}
+	return ret, nil
+}
+
+// Derive follows path from e.
+func (e *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	var err error
+	for _, i := range path {
+		e, err = e.Child(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
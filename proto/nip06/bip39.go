@@ -0,0 +1,124 @@
+package nip06
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed english.txt
+var english string
+
+var (
+	wordList  = strings.Fields(english)
+	wordIndex = func() map[string]int {
+		m := make(map[string]int, len(wordList))
+		for i, w := range wordList {
+			m[w] = i
+		}
+		return m
+	}()
+)
+
+var (
+	ErrEntropySize     = errors.New("bip39: entropy must be 128 to 256 bits in steps of 32")
+	ErrMnemonicLength  = errors.New("bip39: mnemonic must have 12, 15, 18, 21 or 24 words")
+	ErrUnknownWord     = errors.New("bip39: unknown word in mnemonic")
+	ErrInvalidChecksum = errors.New("bip39: invalid mnemonic checksum")
+)
+
+// NewEntropy returns bits of random entropy for a mnemonic.
+func NewEntropy(bits int) ([]byte, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return nil, ErrEntropySize
+	}
+	buf := make([]byte, bits/8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// NewMnemonic returns a random mnemonic of 12 words for 128 bits, up to
+// 24 words for 256.
+func NewMnemonic(bits int) (string, error) {
+	entropy, err := NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes entropy with its checksum as words.
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", ErrEntropySize
+	}
+	csBits := bits / 32
+	hash := sha256.Sum256(entropy)
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, uint(csBits))
+	n.Or(n, big.NewInt(int64(hash[0]>>(8-csBits))))
+
+	words := make([]string, (bits+csBits)/11)
+	mask := big.NewInt(2047)
+	idx := new(big.Int)
+	for i := len(words) - 1; i >= 0; i-- {
+		idx.And(n, mask)
+		words[i] = wordList[idx.Int64()]
+		n.Rsh(n, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic, verifying its checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, ErrMnemonicLength
+	}
+	n := new(big.Int)
+	for _, w := range words {
+		i, ok := wordIndex[strings.ToLower(w)]
+		if !ok {
+			return nil, ErrUnknownWord
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+	csBits := len(words) * 11 / 33
+	checksum := new(big.Int).And(n, big.NewInt(1<<csBits-1)).Int64()
+	n.Rsh(n, uint(csBits))
+
+	entropy := n.FillBytes(make([]byte, csBits*4))
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-csBits)) != checksum {
+		return nil, ErrInvalidChecksum
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic reports whether mnemonic is well formed.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+// Seed derives the 64 byte BIP-32 seed for a mnemonic and optional
+// passphrase. It does not validate the mnemonic.
+func Seed(mnemonic, passphrase string) []byte {
+	m := strings.Join(strings.Fields(norm.NFKD.String(mnemonic)), " ")
+	salt := "mnemonic" + norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(m), []byte(salt), 2048, 64, sha512.New)
+}
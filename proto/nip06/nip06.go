@@ -0,0 +1,38 @@
+// Package nip06 derives nostr keys from BIP-39 mnemonics along the
+// BIP-32 path m/44'/1237'/<account>'/0/0.
+package nip06
+
+import (
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// CoinType is nostr's SLIP-44 coin type.
+const CoinType = 1237
+
+// Path returns the derivation path for account.
+func Path(account uint32) []uint32 {
+	return []uint32{44 + Hardened, CoinType + Hardened, account + Hardened, 0, 0}
+}
+
+// PrivateKeyFromSeed derives the key for account from a BIP-32 seed.
+func PrivateKeyFromSeed(seed []byte, account uint32) (*secp256k1.PrivateKey, error) {
+	master, err := NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	k, err := master.Derive(Path(account))
+	if err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+// PrivateKeyFromMnemonic validates mnemonic and derives the key for
+// account from it and the optional passphrase.
+func PrivateKeyFromMnemonic(mnemonic, passphrase string, account uint32) (*secp256k1.PrivateKey, error) {
+	err := ValidateMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	return PrivateKeyFromSeed(Seed(mnemonic, passphrase), account)
+}
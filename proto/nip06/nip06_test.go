@@ -0,0 +1,119 @@
+package nip06
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+func TestNIP06Vectors(t *testing.T) {
+	for _, v := range []struct {
+		mnemonic, priv, nsec, pub, npub string
+	}{
+		{
+			"leader monkey parrot ring guide accident before fence cannon height naive bean",
+			"7f7ff03d123792d6ac594bfa67bf6d0c0ab55b6b1fdb6249303fe861f1ccba9a",
+			"nsec10allq0gjx7fddtzef0ax00mdps9t2kmtrldkyjfs8l5xruwvh2dq0lhhkp",
+			"17162c921dc4d2518f9a101db33695df1afb56ab82f5ff3e5da6eec3ca5cd917",
+			"npub1zutzeysacnf9rru6zqwmxd54mud0k44tst6l70ja5mhv8jjumytsd2x7nu",
+		},
+		{
+			"what bleak badge arrange retreat wolf trade produce cricket blur garlic valid proud rude strong choose busy staff weather area salt hollow arm fade",
+			"c15d739894c81a2fcfd3a2df85a0d2c0dbc47a280d092799f144d73d7ae78add",
+			"nsec1c9wh8xy5eqdzln7n5t0ctgxjcrdug73gp5yj0x03gntn67h83twssdfhel",
+			"d41b22899549e1f3d335a31002cfd382174006e166d3e658e3a5eecdb6463573",
+			"npub16sdj9zv4f8sl85e45vgq9n7nsgt5qphpvmf7vk8r5hhvmdjxx4es8rq74h",
+		},
+	} {
+		key, err := PrivateKeyFromMnemonic(v.mnemonic, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key.Serialize()); got != v.priv {
+			t.Fatalf("private key %s, want %s", got, v.priv)
+		}
+		if nsec, _ := nip19.EncodePrivateKey(key); nsec != v.nsec {
+			t.Fatalf("nsec %s, want %s", nsec, v.nsec)
+		}
+		pub := common.PubKeyHex(key.PubKey())
+		if pub != v.pub {
+			t.Fatalf("public key %s, want %s", pub, v.pub)
+		}
+		if npub, _ := nip19.EncodePubKey(pub); npub != v.npub {
+			t.Fatalf("npub %s, want %s", npub, v.npub)
+		}
+	}
+}
+
+func TestBIP39(t *testing.T) {
+	// from the reference vectors, which all use the passphrase TREZOR
+	for _, v := range []struct {
+		entropy, mnemonic, seed string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	} {
+		entropy, _ := hex.DecodeString(v.entropy)
+		m, err := EntropyToMnemonic(entropy)
+		if err != nil || m != v.mnemonic {
+			t.Fatal(m, err)
+		}
+		back, err := MnemonicToEntropy(m)
+		if err != nil || hex.EncodeToString(back) != v.entropy {
+			t.Fatal(back, err)
+		}
+		if seed := hex.EncodeToString(Seed(m, "TREZOR")); seed != v.seed {
+			t.Fatal(seed)
+		}
+	}
+
+	bad := strings.Replace("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "about", "abandon", 1)
+	if err := ValidateMnemonic(bad); err != ErrInvalidChecksum {
+		t.Fatal(err)
+	}
+	if err := ValidateMnemonic("abandon nostr"); err != ErrMnemonicLength {
+		t.Fatal(err)
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	m, err := NewMnemonic(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Fields(m)) != 24 || ValidateMnemonic(m) != nil {
+		t.Fatal(m)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	p, err := ParsePath("m/44'/1237'/3h/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Path(3)
+	for i := range want {
+		if p[i] != want[i] {
+			t.Fatal(p)
+		}
+	}
+	if _, err := ParsePath("44'/0"); err != ErrInvalidPath {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package nip10 builds and parses the e and p tags that thread replies,
+// and rebuilds threads from sets of events.
+package nip10
+
+import (
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+const (
+	MarkerRoot    = "root"
+	MarkerReply   = "reply"
+	MarkerMention = "mention"
+)
+
+// Pointer is an event referenced by an e tag, with the optional relay
+// hint and author.
+type Pointer struct {
+	ID     string
+	Relay  string
+	PubKey string
+}
+
+// Refs are the events an event references. Root and Reply are nil if it
+// isn't a reply; a direct reply to the root has both set to the root.
+type Refs struct {
+	Root     *Pointer
+	Reply    *Pointer
+	Mentions []Pointer
+}
+
+func pointer(t []string) *Pointer {
+	p := &Pointer{ID: t[1]}
+	if len(t) > 2 {
+		p.Relay = t[2]
+	}
+	if len(t) > 4 {
+		p.PubKey = t[4]
+	}
+	return p
+}
+
+func tag(p *Pointer, marker string) []string {
+	t := []string{"e", p.ID, p.Relay, marker}
+	if p.PubKey != "" {
+		t = append(t, p.PubKey)
+	}
+	return t
+}
+
+// Parse reads the references of an event, understanding both marked e
+// tags and the deprecated positional scheme, where the first e tag is
+// the root, the last the reply and any between mentions.
+func Parse(e *proto.Event) *Refs {
+	var etags [][]string
+	marked := false
+	for _, t := range e.Tags {
+		if len(t) < 2 || t[0] != "e" {
+			continue
+		}
+		etags = append(etags, t)
+		if len(t) > 3 && (t[3] == MarkerRoot || t[3] == MarkerReply) {
+			marked = true
+		}
+	}
+
+	r := &Refs{}
+	if marked {
+		for _, t := range etags {
+			marker := ""
+			if len(t) > 3 {
+				marker = t[3]
+			}
+			switch marker {
+			case MarkerRoot:
+				r.Root = pointer(t)
+			case MarkerReply:
+				r.Reply = pointer(t)
+			default:
+				r.Mentions = append(r.Mentions, *pointer(t))
+			}
+		}
+		if r.Root == nil {
+			r.Root = r.Reply
+		}
+		if r.Reply == nil {
+			r.Reply = r.Root
+		}
+		return r
+	}
+
+	if len(etags) == 0 {
+		return r
+	}
+	r.Root = pointer(etags[0])
+	r.Reply = pointer(etags[len(etags)-1])
+	for i := 1; i < len(etags)-1; i++ {
+		r.Mentions = append(r.Mentions, *pointer(etags[i]))
+	}
+	return r
+}
+
+// ReplyTags returns the tags for a reply to parent, which was seen on
+// relay (optional): marked root and reply e tags, and p tags for the
+// parent's author and everyone it tagged.
+func ReplyTags(parent *proto.Event, relay string) [][]string {
+	self := &Pointer{ID: parent.ID, Relay: relay, PubKey: parent.PubKey}
+	var tags [][]string
+	if root := Parse(parent).Root; root != nil {
+		tags = append(tags, tag(root, MarkerRoot), tag(self, MarkerReply))
+	} else {
+		tags = append(tags, tag(self, MarkerRoot))
+	}
+
+	seen := map[string]bool{parent.PubKey: true}
+	tags = append(tags, []string{"p", parent.PubKey})
+	for _, t := range parent.Tags {
+		if len(t) >= 2 && t[0] == "p" && !seen[t[1]] {
+			seen[t[1]] = true
+			tags = append(tags, []string{"p", t[1]})
+		}
+	}
+	return tags
+}
+
+// NewReply returns an unsigned kind 1 reply to parent.
+func NewReply(parent *proto.Event, relay, content string) *proto.Event {
+	return &proto.Event{
+		Kind:      1,
+		CreatedAt: time.Now().Unix(),
+		Tags:      ReplyTags(parent, relay),
+		Content:   content,
+	}
+}
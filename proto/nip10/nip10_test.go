@@ -0,0 +1,94 @@
+package nip10
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+)
+
+func TestReplyTags(t *testing.T) {
+	alice := common.GeneratePrivateKey()
+	bob := common.GeneratePrivateKey()
+	carol := common.GeneratePrivateKey()
+
+	root := &proto.Event{Kind: 1, Content: "root", Tags: [][]string{{"p", "someone"}}}
+	root.Sign(alice)
+	reply := NewReply(root, "wss://a", "reply")
+	reply.Sign(bob)
+	if !reflect.DeepEqual(reply.Tags, [][]string{
+		{"e", root.ID, "wss://a", "root", root.PubKey},
+		{"p", root.PubKey},
+		{"p", "someone"},
+	}) {
+		t.Fatal(reply.Tags)
+	}
+	r := Parse(reply)
+	if r.Root.ID != root.ID || r.Reply.ID != root.ID || r.Root.PubKey != root.PubKey {
+		t.Fatal(r)
+	}
+
+	nested := NewReply(reply, "wss://b", "nested")
+	nested.Sign(carol)
+	r = Parse(nested)
+	if r.Root.ID != root.ID || r.Root.Relay != "wss://a" || r.Reply.ID != reply.ID || r.Reply.Relay != "wss://b" {
+		t.Fatal(r)
+	}
+	if len(nested.Tags) != 5 {
+		t.Fatal(nested.Tags)
+	}
+}
+
+func TestParsePositional(t *testing.T) {
+	r := Parse(&proto.Event{Tags: [][]string{{"e", "a"}}})
+	if r.Root.ID != "a" || r.Reply.ID != "a" {
+		t.Fatal(r)
+	}
+	r = Parse(&proto.Event{Tags: [][]string{{"e", "a", "wss://r"}, {"p", "x"}, {"e", "b"}, {"e", "c"}}})
+	if r.Root.ID != "a" || r.Root.Relay != "wss://r" || r.Reply.ID != "c" || len(r.Mentions) != 1 || r.Mentions[0].ID != "b" {
+		t.Fatal(r)
+	}
+	r = Parse(&proto.Event{Tags: [][]string{{"e", "m", "", "mention"}, {"e", "a", "", "root"}}})
+	if r.Root.ID != "a" || r.Reply.ID != "a" || len(r.Mentions) != 1 {
+		t.Fatal(r)
+	}
+	if r := Parse(&proto.Event{}); r.Root != nil || r.Reply != nil {
+		t.Fatal(r)
+	}
+}
+
+func TestBuildThread(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	root := &proto.Event{Kind: 1, CreatedAt: 1, Content: "root"}
+	root.Sign(key)
+	a := NewReply(root, "", "a")
+	a.CreatedAt = 3
+	a.Sign(key)
+	b := NewReply(root, "", "b")
+	b.CreatedAt = 2
+	b.Sign(key)
+	c := NewReply(a, "", "c")
+	c.CreatedAt = 4
+	c.Sign(key)
+	orphan := NewReply(&proto.Event{ID: "missing"}, "", "orphan")
+	orphan.CreatedAt = 5
+	orphan.Sign(key)
+	// a cycle through made up ids
+	x := &proto.Event{ID: "x", CreatedAt: 6, Tags: [][]string{{"e", "y"}}}
+	y := &proto.Event{ID: "y", CreatedAt: 7, Tags: [][]string{{"e", "x"}}}
+	z := &proto.Event{ID: "z", CreatedAt: 8, Tags: [][]string{{"e", "x"}}}
+
+	var got []string
+	Walk(BuildThread([]*proto.Event{z, c, orphan, a, root, b, a, y, x}), func(n *Node, depth int) {
+		got = append(got, string(rune('0'+depth))+n.Event.Content+n.Event.ID[:1])
+	})
+	want := []string{
+		"0root" + root.ID[:1], "1b" + b.ID[:1], "1a" + a.ID[:1], "2c" + c.ID[:1],
+		"0orphan" + orphan.ID[:1],
+		"0y", "1x", "2z",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+}
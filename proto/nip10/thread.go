@@ -0,0 +1,80 @@
+package nip10
+
+import (
+	"sort"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+type Node struct {
+	Event    *proto.Event
+	Children []*Node
+}
+
+// BuildThread arranges events into reply trees. Events whose parent isn't
+// among them are returned as roots; roots and children are ordered by
+// created_at, and duplicate events are dropped.
+func BuildThread(events []*proto.Event) []*Node {
+	nodes := map[string]*Node{}
+	var order []*Node
+	for _, e := range events {
+		if nodes[e.ID] != nil {
+			continue
+		}
+		n := &Node{Event: e}
+		nodes[e.ID] = n
+		order = append(order, n)
+	}
+
+	parents := map[*Node]*Node{}
+	for _, n := range order {
+		reply := Parse(n.Event).Reply
+		if reply != nil && nodes[reply.ID] != nil && nodes[reply.ID] != n {
+			parents[n] = nodes[reply.ID]
+		}
+	}
+	// break reply cycles, which can only come from made up ids, by making
+	// the first node found in one a root
+	for _, n := range order {
+		seen := map[*Node]bool{}
+		for p := parents[n]; p != nil && !seen[p]; p = parents[p] {
+			if p == n {
+				delete(parents, n)
+				break
+			}
+			seen[p] = true
+		}
+	}
+
+	var roots []*Node
+	for _, n := range order {
+		if p := parents[n]; p != nil {
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
+
+func sortNodes(nodes []*Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Event.CreatedAt < nodes[j].Event.CreatedAt
+	})
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+}
+
+// Walk calls f for every node depth first, with its depth in the tree.
+func Walk(nodes []*Node, f func(n *Node, depth int)) {
+	var walk func(nodes []*Node, depth int)
+	walk = func(nodes []*Node, depth int) {
+		for _, n := range nodes {
+			f(n, depth)
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(nodes, 0)
+}
@@ -0,0 +1,120 @@
+// Package nip17 builds private direct messages: kind 14 rumors delivered
+// to each participant as NIP-59 gift wraps, and the kind 10050 list of
+// relays a user wants to receive them on.
+package nip17
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip59"
+	"github.com/andyleap/nostr/signer"
+)
+
+const (
+	KindPrivateDirectMessage = 14
+	KindInboxRelays          = 10050
+)
+
+var (
+	ErrWrongKind      = errors.New("nip17: not a private direct message")
+	ErrNoParticipants = errors.New("nip17: message has no recipients")
+)
+
+// NewMessage returns an unsigned kind 14 rumor from sender to recipients.
+func NewMessage(sender string, recipients []string, content string) *proto.Event {
+	e := &proto.Event{
+		PubKey:    sender,
+		Kind:      KindPrivateDirectMessage,
+		CreatedAt: time.Now().Unix(),
+		Tags:      [][]string{},
+		Content:   content,
+	}
+	for _, r := range recipients {
+		e.Tags = append(e.Tags, []string{"p", r})
+	}
+	return e
+}
+
+// Recipients returns the pubkeys in the p tags of a message.
+func Recipients(e *proto.Event) []string {
+	var ret []string
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == "p" {
+			ret = append(ret, t[1])
+		}
+	}
+	return ret
+}
+
+// Wrap gift wraps a message for every recipient and for the sender, so the
+// sender can read their own copy back. Each wrap's p tag names who it is
+// for.
+func Wrap(ctx context.Context, s signer.Signer, msg *proto.Event) ([]*proto.Event, error) {
+	if msg.Kind != KindPrivateDirectMessage {
+		return nil, ErrWrongKind
+	}
+	recipients := Recipients(msg)
+	if len(recipients) == 0 {
+		return nil, ErrNoParticipants
+	}
+	sender, err := s.GetPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var wraps []*proto.Event
+	for _, r := range append(recipients, sender) {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		w, err := nip59.GiftWrap(ctx, s, msg, r)
+		if err != nil {
+			return nil, err
+		}
+		wraps = append(wraps, w)
+	}
+	return wraps, nil
+}
+
+// Open unwraps a gift wrap and returns the kind 14 message inside.
+func Open(ctx context.Context, s signer.Signer, wrap *proto.Event) (*proto.Event, error) {
+	msg, err := nip59.Open(ctx, s, wrap)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Kind != KindPrivateDirectMessage {
+		return nil, ErrWrongKind
+	}
+	return msg, nil
+}
+
+// NewInboxRelays returns an unsigned kind 10050 event listing relays.
+func NewInboxRelays(relays []string) *proto.Event {
+	e := &proto.Event{
+		Kind:      KindInboxRelays,
+		CreatedAt: time.Now().Unix(),
+		Tags:      [][]string{},
+	}
+	for _, r := range relays {
+		e.Tags = append(e.Tags, []string{"relay", r})
+	}
+	return e
+}
+
+// InboxRelays returns the relays listed in a kind 10050 event.
+func InboxRelays(e *proto.Event) []string {
+	if e.Kind != KindInboxRelays {
+		return nil
+	}
+	var ret []string
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == "relay" {
+			ret = append(ret, t[1])
+		}
+	}
+	return ret
+}
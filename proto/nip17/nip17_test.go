@@ -0,0 +1,49 @@
+package nip17
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip59"
+	"github.com/andyleap/nostr/signer"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestWrap(t *testing.T) {
+	alice := common.GeneratePrivateKey()
+	bob := common.GeneratePrivateKey()
+	alicePK := common.PubKeyHex(alice.PubKey())
+	bobPK := common.PubKeyHex(bob.PubKey())
+
+	msg := NewMessage(alicePK, []string{bobPK}, "hi bob")
+	ctx := context.Background()
+	wraps, err := Wrap(ctx, signer.NewKeySigner(alice), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wraps) != 2 {
+		t.Fatalf("expected wraps for bob and alice, got %d", len(wraps))
+	}
+	for i, key := range []*secp256k1.PrivateKey{bob, alice} {
+		r, _ := nip59.Recipient(wraps[i])
+		if r != common.PubKeyHex(key.PubKey()) {
+			t.Fatalf("wrap %d is for %s", i, r)
+		}
+		got, err := Open(ctx, signer.NewKeySigner(key), wraps[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Content != "hi bob" || got.PubKey != alicePK || Recipients(got)[0] != bobPK {
+			t.Fatalf("bad message %+v", got)
+		}
+	}
+}
+
+func TestInboxRelays(t *testing.T) {
+	e := NewInboxRelays([]string{"wss://a", "wss://b"})
+	got := InboxRelays(e)
+	if len(got) != 2 || got[0] != "wss://a" || got[1] != "wss://b" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,168 @@
+package nip19
+
+import (
+	"errors"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// MaxLength is the longest bech32 string accepted by Decode. It is well
+// past the 90 characters of BIP-173 since TLV entities carry relay URLs.
+const MaxLength = 5000
+
+var (
+	ErrInvalidBech32   = errors.New("invalid bech32 string")
+	ErrMixedCase       = errors.New("bech32 string has mixed case")
+	ErrInvalidChecksum = errors.New("invalid bech32 checksum")
+	ErrInvalidPadding  = errors.New("invalid bech32 padding")
+)
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	ret := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]>>5)
+	}
+	ret = append(ret, 0)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]&31)
+	}
+	return ret
+}
+
+func createChecksum(hrp string, data []byte) []byte {
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := polymod(values) ^ 1
+	ret := make([]byte, 6)
+	for i := range ret {
+		ret[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return ret
+}
+
+// encodeBech32 encodes 5-bit groups under hrp.
+func encodeBech32(hrp string, data []byte) string {
+	combined := append(append([]byte{}, data...), createChecksum(hrp, data)...)
+	var sb strings.Builder
+	sb.Grow(len(hrp) + 1 + len(combined))
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, b := range combined {
+		sb.WriteByte(charset[b])
+	}
+	return sb.String()
+}
+
+// decodeBech32 returns the lowercased hrp and the 5-bit groups of s,
+// without the checksum.
+func decodeBech32(s string) (string, []byte, error) {
+	if len(s) < 8 || len(s) > MaxLength {
+		return "", nil, ErrInvalidBech32
+	}
+	lower, upper := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", nil, ErrInvalidBech32
+		}
+		if c >= 'a' && c <= 'z' {
+			lower = true
+		}
+		if c >= 'A' && c <= 'Z' {
+			upper = true
+		}
+	}
+	if lower && upper {
+		return "", nil, ErrMixedCase
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, ErrInvalidBech32
+	}
+	hrp := s[:pos]
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(charset, s[i])
+		if d < 0 {
+			return "", nil, ErrInvalidBech32
+		}
+		data = append(data, byte(d))
+	}
+	if polymod(append(hrpExpand(hrp), data...)) != 1 {
+		return "", nil, ErrInvalidChecksum
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// convertBits regroups data from fromBits-wide groups to toBits-wide
+// groups. When pad is false, leftover bits must be fewer than fromBits and
+// all zero.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<toBits - 1
+	ret := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, ErrInvalidBech32
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			ret = append(ret, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, ErrInvalidPadding
+	}
+	return ret, nil
+}
+
+// EncodeBytes encodes raw bytes as a bech32 string with the given prefix.
+func EncodeBytes(hrp string, data []byte) (string, error) {
+	conv, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	s := encodeBech32(hrp, conv)
+	if len(s) > MaxLength {
+		return "", ErrInvalidBech32
+	}
+	return s, nil
+}
+
+// DecodeBytes decodes a bech32 string into its prefix and raw bytes.
+func DecodeBytes(s string) (string, []byte, error) {
+	hrp, data, err := decodeBech32(s)
+	if err != nil {
+		return "", nil, err
+	}
+	conv, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, conv, nil
+}
@@ -0,0 +1,501 @@
+// Package nip19 implements the bech32-encoded entities described in NIP-19:
+// npub, nsec and note for bare keys and ids, and the TLV based nprofile,
+// nevent, naddr and nrelay.
+package nip19
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	PrefixPubKey     = "npub"
+	PrefixPrivateKey = "nsec"
+	PrefixNote       = "note"
+	PrefixProfile    = "nprofile"
+	PrefixEvent      = "nevent"
+	PrefixAddr       = "naddr"
+	PrefixRelay      = "nrelay"
+)
+
+const (
+	tlvSpecial byte = 0
+	tlvRelay   byte = 1
+	tlvAuthor  byte = 2
+	tlvKind    byte = 3
+)
+
+var (
+	ErrUnknownPrefix  = errors.New("unknown nip19 prefix")
+	ErrInvalidLength  = errors.New("invalid nip19 data length")
+	ErrInvalidKey     = errors.New("invalid private key")
+	ErrInvalidHex     = errors.New("invalid hex value")
+	ErrInvalidTLV     = errors.New("invalid nip19 tlv")
+	ErrMissingTLV     = errors.New("missing required nip19 tlv")
+	ErrInvalidString  = errors.New("invalid utf-8 in nip19 tlv")
+	ErrValueTooLarge  = errors.New("nip19 tlv value too large")
+	ErrUnexpectedType = errors.New("unexpected nip19 entity type")
+)
+
+// ProfilePointer is the payload of an nprofile.
+type ProfilePointer struct {
+	PubKey string   `json:"pubkey"`
+	Relays []string `json:"relays,omitempty"`
+}
+
+// EventPointer is the payload of an nevent. Author and Kind are optional.
+type EventPointer struct {
+	ID     string   `json:"id"`
+	Relays []string `json:"relays,omitempty"`
+	Author string   `json:"author,omitempty"`
+	Kind   *int64   `json:"kind,omitempty"`
+}
+
+// EntityPointer is the payload of an naddr, addressing a parameterized
+// replaceable event by kind, author and d tag.
+type EntityPointer struct {
+	Identifier string   `json:"identifier"`
+	PubKey     string   `json:"pubkey"`
+	Kind       int64    `json:"kind"`
+	Relays     []string `json:"relays,omitempty"`
+}
+
+func decodeHex32(s string) ([]byte, error) {
+	if len(s) != 64 || strings.ToLower(s) != s {
+		return nil, ErrInvalidHex
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidHex
+	}
+	return b, nil
+}
+
+func EncodePubKey(pubKey string) (string, error) {
+	b, err := decodeHex32(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBytes(PrefixPubKey, b)
+}
+
+func EncodePrivateKey(key *secp256k1.PrivateKey) (string, error) {
+	return EncodeBytes(PrefixPrivateKey, key.Serialize())
+}
+
+func EncodeNote(id string) (string, error) {
+	b, err := decodeHex32(id)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBytes(PrefixNote, b)
+}
+
+func EncodeProfile(p *ProfilePointer) (string, error) {
+	pk, err := decodeHex32(p.PubKey)
+	if err != nil {
+		return "", err
+	}
+	var buf []byte
+	buf, err = appendTLV(buf, tlvSpecial, pk)
+	if err != nil {
+		return "", err
+	}
+	buf, err = appendRelays(buf, p.Relays)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBytes(PrefixProfile, buf)
+}
+
+func EncodeEvent(p *EventPointer) (string, error) {
+	id, err := decodeHex32(p.ID)
+	if err != nil {
+		return "", err
+	}
+	var buf []byte
+	buf, err = appendTLV(buf, tlvSpecial, id)
+	if err != nil {
+		return "", err
+	}
+	buf, err = appendRelays(buf, p.Relays)
+	if err != nil {
+		return "", err
+	}
+	if p.Author != "" {
+		author, err := decodeHex32(p.Author)
+		if err != nil {
+			return "", err
+		}
+		buf, err = appendTLV(buf, tlvAuthor, author)
+		if err != nil {
+			return "", err
+		}
+	}
+	if p.Kind != nil {
+		buf, err = appendKind(buf, *p.Kind)
+		if err != nil {
+			return "", err
+		}
+	}
+	return EncodeBytes(PrefixEvent, buf)
+}
+
+func EncodeAddr(p *EntityPointer) (string, error) {
+	pk, err := decodeHex32(p.PubKey)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(p.Identifier) {
+		return "", ErrInvalidString
+	}
+	var buf []byte
+	buf, err = appendTLV(buf, tlvSpecial, []byte(p.Identifier))
+	if err != nil {
+		return "", err
+	}
+	buf, err = appendRelays(buf, p.Relays)
+	if err != nil {
+		return "", err
+	}
+	buf, err = appendTLV(buf, tlvAuthor, pk)
+	if err != nil {
+		return "", err
+	}
+	buf, err = appendKind(buf, p.Kind)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBytes(PrefixAddr, buf)
+}
+
+func EncodeRelay(url string) (string, error) {
+	if url == "" || !utf8.ValidString(url) {
+		return "", ErrInvalidString
+	}
+	buf, err := appendTLV(nil, tlvSpecial, []byte(url))
+	if err != nil {
+		return "", err
+	}
+	return EncodeBytes(PrefixRelay, buf)
+}
+
+func appendTLV(buf []byte, t byte, v []byte) ([]byte, error) {
+	if len(v) > 255 {
+		return nil, ErrValueTooLarge
+	}
+	buf = append(buf, t, byte(len(v)))
+	return append(buf, v...), nil
+}
+
+func appendRelays(buf []byte, relays []string) ([]byte, error) {
+	var err error
+	for _, r := range relays {
+		if r == "" || !utf8.ValidString(r) {
+			return nil, ErrInvalidString
+		}
+		buf, err = appendTLV(buf, tlvRelay, []byte(r))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendKind(buf []byte, kind int64) ([]byte, error) {
+	if kind < 0 || kind > 0xffffffff {
+		return nil, fmt.Errorf("%w: kind %d out of range", ErrInvalidTLV, kind)
+	}
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(kind))
+	return appendTLV(buf, tlvKind, k)
+}
+
+type tlv struct {
+	t byte
+	v []byte
+}
+
+func parseTLV(data []byte) ([]tlv, error) {
+	var ret []tlv
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, ErrInvalidTLV
+		}
+		t, l := data[0], int(data[1])
+		if len(data) < 2+l {
+			return nil, ErrInvalidTLV
+		}
+		ret = append(ret, tlv{t: t, v: data[2 : 2+l]})
+		data = data[2+l:]
+	}
+	return ret, nil
+}
+
+// Decode decodes any NIP-19 entity. The returned value depends on the
+// prefix:
+//
+//	npub, note         string (lowercase hex)
+//	nsec               *secp256k1.PrivateKey
+//	nprofile           *ProfilePointer
+//	nevent             *EventPointer
+//	naddr              *EntityPointer
+//	nrelay             string (relay url)
+//
+// Unknown TLV types are ignored as the NIP requires; everything else is
+// validated strictly.
+func Decode(s string) (string, interface{}, error) {
+	prefix, data, err := DecodeBytes(s)
+	if err != nil {
+		return "", nil, err
+	}
+	switch prefix {
+	case PrefixPubKey, PrefixNote:
+		if len(data) != 32 {
+			return "", nil, ErrInvalidLength
+		}
+		return prefix, hex.EncodeToString(data), nil
+	case PrefixPrivateKey:
+		if len(data) != 32 {
+			return "", nil, ErrInvalidLength
+		}
+		var k secp256k1.ModNScalar
+		if overflow := k.SetByteSlice(data); overflow || k.IsZero() {
+			return "", nil, ErrInvalidKey
+		}
+		return prefix, secp256k1.NewPrivateKey(&k), nil
+	case PrefixProfile:
+		v, err := decodeProfile(data)
+		return prefix, v, err
+	case PrefixEvent:
+		v, err := decodeEvent(data)
+		return prefix, v, err
+	case PrefixAddr:
+		v, err := decodeAddr(data)
+		return prefix, v, err
+	case PrefixRelay:
+		v, err := decodeRelay(data)
+		return prefix, v, err
+	}
+	return "", nil, ErrUnknownPrefix
+}
+
+func decodeRelayTLV(v []byte) (string, error) {
+	if len(v) == 0 || !utf8.Valid(v) {
+		return "", ErrInvalidString
+	}
+	return string(v), nil
+}
+
+func decodeProfile(data []byte) (*ProfilePointer, error) {
+	tlvs, err := parseTLV(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &ProfilePointer{}
+	for _, t := range tlvs {
+		switch t.t {
+		case tlvSpecial:
+			if p.PubKey != "" {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 32 {
+				return nil, ErrInvalidLength
+			}
+			p.PubKey = hex.EncodeToString(t.v)
+		case tlvRelay:
+			r, err := decodeRelayTLV(t.v)
+			if err != nil {
+				return nil, err
+			}
+			p.Relays = append(p.Relays, r)
+		}
+	}
+	if p.PubKey == "" {
+		return nil, ErrMissingTLV
+	}
+	return p, nil
+}
+
+func decodeEvent(data []byte) (*EventPointer, error) {
+	tlvs, err := parseTLV(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &EventPointer{}
+	for _, t := range tlvs {
+		switch t.t {
+		case tlvSpecial:
+			if p.ID != "" {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 32 {
+				return nil, ErrInvalidLength
+			}
+			p.ID = hex.EncodeToString(t.v)
+		case tlvRelay:
+			r, err := decodeRelayTLV(t.v)
+			if err != nil {
+				return nil, err
+			}
+			p.Relays = append(p.Relays, r)
+		case tlvAuthor:
+			if p.Author != "" {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 32 {
+				return nil, ErrInvalidLength
+			}
+			p.Author = hex.EncodeToString(t.v)
+		case tlvKind:
+			if p.Kind != nil {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 4 {
+				return nil, ErrInvalidLength
+			}
+			k := int64(binary.BigEndian.Uint32(t.v))
+			p.Kind = &k
+		}
+	}
+	if p.ID == "" {
+		return nil, ErrMissingTLV
+	}
+	return p, nil
+}
+
+func decodeAddr(data []byte) (*EntityPointer, error) {
+	tlvs, err := parseTLV(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &EntityPointer{}
+	haveIdent, haveKind := false, false
+	for _, t := range tlvs {
+		switch t.t {
+		case tlvSpecial:
+			if haveIdent {
+				return nil, ErrInvalidTLV
+			}
+			if !utf8.Valid(t.v) {
+				return nil, ErrInvalidString
+			}
+			p.Identifier = string(t.v)
+			haveIdent = true
+		case tlvRelay:
+			r, err := decodeRelayTLV(t.v)
+			if err != nil {
+				return nil, err
+			}
+			p.Relays = append(p.Relays, r)
+		case tlvAuthor:
+			if p.PubKey != "" {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 32 {
+				return nil, ErrInvalidLength
+			}
+			p.PubKey = hex.EncodeToString(t.v)
+		case tlvKind:
+			if haveKind {
+				return nil, ErrInvalidTLV
+			}
+			if len(t.v) != 4 {
+				return nil, ErrInvalidLength
+			}
+			p.Kind = int64(binary.BigEndian.Uint32(t.v))
+			haveKind = true
+		}
+	}
+	if !haveIdent || !haveKind || p.PubKey == "" {
+		return nil, ErrMissingTLV
+	}
+	return p, nil
+}
+
+func decodeRelay(data []byte) (string, error) {
+	tlvs, err := parseTLV(data)
+	if err != nil {
+		return "", err
+	}
+	url := ""
+	for _, t := range tlvs {
+		if t.t != tlvSpecial {
+			continue
+		}
+		if url != "" {
+			return "", ErrInvalidTLV
+		}
+		url, err = decodeRelayTLV(t.v)
+		if err != nil {
+			return "", err
+		}
+	}
+	if url == "" {
+		return "", ErrMissingTLV
+	}
+	return url, nil
+}
+
+// DecodePubKey accepts a hex public key, an npub or an nprofile and returns
+// the hex public key.
+func DecodePubKey(s string) (string, error) {
+	if _, err := decodeHex32(s); err == nil {
+		return s, nil
+	}
+	prefix, v, err := Decode(s)
+	if err != nil {
+		return "", err
+	}
+	switch prefix {
+	case PrefixPubKey:
+		return v.(string), nil
+	case PrefixProfile:
+		return v.(*ProfilePointer).PubKey, nil
+	}
+	return "", ErrUnexpectedType
+}
+
+// DecodeEventID accepts a hex event id, a note or an nevent and returns the
+// hex event id.
+func DecodeEventID(s string) (string, error) {
+	if _, err := decodeHex32(s); err == nil {
+		return s, nil
+	}
+	prefix, v, err := Decode(s)
+	if err != nil {
+		return "", err
+	}
+	switch prefix {
+	case PrefixNote:
+		return v.(string), nil
+	case PrefixEvent:
+		return v.(*EventPointer).ID, nil
+	}
+	return "", ErrUnexpectedType
+}
+
+// DecodePrivateKey accepts a hex private key or an nsec.
+func DecodePrivateKey(s string) (*secp256k1.PrivateKey, error) {
+	if b, err := decodeHex32(s); err == nil {
+		var k secp256k1.ModNScalar
+		if overflow := k.SetByteSlice(b); overflow || k.IsZero() {
+			return nil, ErrInvalidKey
+		}
+		return secp256k1.NewPrivateKey(&k), nil
+	}
+	prefix, v, err := Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != PrefixPrivateKey {
+		return nil, ErrUnexpectedType
+	}
+	return v.(*secp256k1.PrivateKey), nil
+}
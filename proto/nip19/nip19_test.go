@@ -0,0 +1,117 @@
+package nip19
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestSpecVectors(t *testing.T) {
+	prefix, v, err := Decode("npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg")
+	if err != nil || prefix != PrefixPubKey || v != "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e" {
+		t.Fatal("npub", prefix, v, err)
+	}
+	prefix, v, err = Decode("nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5")
+	if err != nil || prefix != PrefixPrivateKey {
+		t.Fatal("nsec", prefix, v, err)
+	}
+	if hex.EncodeToString(v.(*secp256k1.PrivateKey).Serialize()) != "67dea2ed018072d675f5415ecfaed7d2597555e202d85b3d65ea4e58d2d92ffa" {
+		t.Fatal("nsec value mismatch")
+	}
+	prefix, v, err = Decode("nprofile1qqsrhuxx8l9ex335q7he0f09aej04zpazpl0ne2cgukyawd24mayt8gpp4mhxue69uhhytnc9e3k7mgpz4mhxue69uhkg6nzv9ejuumpv34kytnrdaksjlyr9p")
+	if err != nil || prefix != PrefixProfile {
+		t.Fatal("nprofile", prefix, v, err)
+	}
+	want := &ProfilePointer{
+		PubKey: "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d",
+		Relays: []string{"wss://r.x.com", "wss://djbas.sadkb.com"},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("nprofile got %+v", v)
+	}
+	s, err := EncodeProfile(want)
+	if err != nil || s != "nprofile1qqsrhuxx8l9ex335q7he0f09aej04zpazpl0ne2cgukyawd24mayt8gpp4mhxue69uhhytnc9e3k7mgpz4mhxue69uhkg6nzv9ejuumpv34kytnrdaksjlyr9p" {
+		t.Fatal("nprofile encode", s, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	pk := strings.Repeat("cd", 32)
+	kind := int64(30023)
+
+	s, _ := EncodeNote(id)
+	if got, err := DecodeEventID(s); err != nil || got != id {
+		t.Fatal("note", got, err)
+	}
+	s, _ = EncodeEvent(&EventPointer{ID: id, Relays: []string{"wss://relay"}, Author: pk, Kind: &kind})
+	_, v, err := Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep := v.(*EventPointer)
+	if ep.ID != id || ep.Author != pk || *ep.Kind != kind || ep.Relays[0] != "wss://relay" {
+		t.Fatalf("nevent got %+v", ep)
+	}
+	s, _ = EncodeAddr(&EntityPointer{Identifier: "hello", PubKey: pk, Kind: kind})
+	_, v, err = Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, &EntityPointer{Identifier: "hello", PubKey: pk, Kind: kind}) {
+		t.Fatalf("naddr got %+v", v)
+	}
+	s, _ = EncodeAddr(&EntityPointer{PubKey: pk, Kind: 30000})
+	if _, v, err = Decode(s); err != nil || v.(*EntityPointer).Identifier != "" {
+		t.Fatal("naddr with empty identifier", v, err)
+	}
+	s, _ = EncodeRelay("wss://relay.example.com")
+	if _, v, err = Decode(s); err != nil || v != "wss://relay.example.com" {
+		t.Fatal("nrelay", v, err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	good, _ := EncodePubKey(strings.Repeat("ab", 32))
+	short, _ := EncodeBytes(PrefixPubKey, make([]byte, 31))
+	noID, _ := EncodeBytes(PrefixEvent, []byte{1, 3, 'w', 's', 's'})
+	truncated, _ := EncodeBytes(PrefixProfile, []byte{0, 32, 1, 2})
+	overflow, _ := EncodeBytes(PrefixPrivateKey, []byte(strings.Repeat("\xff", 32)))
+	unknown, _ := EncodeBytes("nfoo", make([]byte, 32))
+
+	tests := map[string]error{
+		good[:len(good)-1] + "q":             ErrInvalidChecksum,
+		strings.ToUpper(good[:5]) + good[5:]: ErrMixedCase,
+		short:                                ErrInvalidLength,
+		noID:                                 ErrMissingTLV,
+		truncated:                            ErrInvalidTLV,
+		overflow:                             ErrInvalidKey,
+		unknown:                              ErrUnknownPrefix,
+	}
+	for s, want := range tests {
+		if _, _, err := Decode(s); !errors.Is(err, want) {
+			t.Errorf("Decode(%s) = %v, want %v", s, err, want)
+		}
+	}
+	if _, _, err := Decode(strings.ToUpper(good)); err != nil {
+		t.Error("uppercase should decode", err)
+	}
+	if _, err := EncodePubKey(strings.Repeat("AB", 32)); err == nil {
+		t.Error("uppercase hex should be rejected")
+	}
+	if _, err := DecodePubKey(mustNote(t)); !errors.Is(err, ErrUnexpectedType) {
+		t.Error("note accepted as pubkey", err)
+	}
+}
+
+func mustNote(t *testing.T) string {
+	s, err := EncodeNote(strings.Repeat("00", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
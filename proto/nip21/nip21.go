@@ -0,0 +1,232 @@
+// Package nip21 parses nostr: URIs (NIP-21) and the legacy #[n] tag
+// references found in event content, and builds the tags that should
+// accompany them when composing an event.
+package nip21
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+const Scheme = "nostr:"
+
+var (
+	ErrNotNostrURI    = errors.New("not a nostr: uri")
+	ErrPrivateKeyURI  = errors.New("nostr: uris must not contain private keys")
+	ErrUnsupportedURI = errors.New("unsupported nostr: uri")
+)
+
+var (
+	uriRe    = regexp.MustCompile(`(?i)nostr:[a-z]+1[a-z0-9]+`)
+	legacyRe = regexp.MustCompile(`#\[(\d+)\]`)
+)
+
+// Reference is a single mention found in event content. Exactly one of
+// Profile, Event and Entity is set. Start and End are byte offsets into
+// the content; TagIndex is the index into Tags for legacy #[n] references
+// and -1 otherwise.
+type Reference struct {
+	Start    int
+	End      int
+	Text     string
+	TagIndex int
+
+	Profile *nip19.ProfilePointer
+	Event   *nip19.EventPointer
+	Entity  *nip19.EntityPointer
+}
+
+// EncodeURI prefixes a NIP-19 entity with the nostr: scheme.
+func EncodeURI(entity string) string {
+	return Scheme + entity
+}
+
+// ParseURI parses a single nostr: URI into a Reference with zero offsets.
+func ParseURI(uri string) (*Reference, error) {
+	if len(uri) < len(Scheme) || !strings.EqualFold(uri[:len(Scheme)], Scheme) {
+		return nil, ErrNotNostrURI
+	}
+	ref := &Reference{
+		End:      len(uri),
+		Text:     uri,
+		TagIndex: -1,
+	}
+	prefix, v, err := nip19.Decode(uri[len(Scheme):])
+	if err != nil {
+		return nil, err
+	}
+	switch prefix {
+	case nip19.PrefixPubKey:
+		ref.Profile = &nip19.ProfilePointer{PubKey: v.(string)}
+	case nip19.PrefixProfile:
+		ref.Profile = v.(*nip19.ProfilePointer)
+	case nip19.PrefixNote:
+		ref.Event = &nip19.EventPointer{ID: v.(string)}
+	case nip19.PrefixEvent:
+		ref.Event = v.(*nip19.EventPointer)
+	case nip19.PrefixAddr:
+		ref.Entity = v.(*nip19.EntityPointer)
+	case nip19.PrefixPrivateKey:
+		return nil, ErrPrivateKeyURI
+	default:
+		return nil, ErrUnsupportedURI
+	}
+	return ref, nil
+}
+
+// Parse scans content for nostr: URIs and returns them in order of
+// appearance. Anything that looks like a URI but fails to decode is
+// skipped.
+func Parse(content string) []*Reference {
+	var refs []*Reference
+	for _, loc := range uriRe.FindAllStringIndex(content, -1) {
+		ref, err := ParseURI(content[loc[0]:loc[1]])
+		if err != nil {
+			continue
+		}
+		ref.Start = loc[0]
+		ref.End = loc[1]
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// ParseEvent returns every reference in the event content, including
+// legacy #[n] references that point at p, e or a tags, ordered by offset.
+func ParseEvent(e *proto.Event) []*Reference {
+	uris := Parse(e.Content)
+	var legacy []*Reference
+	for _, loc := range legacyRe.FindAllStringSubmatchIndex(e.Content, -1) {
+		idx, err := strconv.Atoi(e.Content[loc[2]:loc[3]])
+		if err != nil || idx >= len(e.Tags) {
+			continue
+		}
+		ref := tagReference(e.Tags[idx])
+		if ref == nil {
+			continue
+		}
+		ref.Start = loc[0]
+		ref.End = loc[1]
+		ref.Text = e.Content[loc[0]:loc[1]]
+		ref.TagIndex = idx
+		legacy = append(legacy, ref)
+	}
+	if len(legacy) == 0 {
+		return uris
+	}
+	refs := make([]*Reference, 0, len(uris)+len(legacy))
+	for len(uris) > 0 || len(legacy) > 0 {
+		if len(legacy) == 0 || (len(uris) > 0 && uris[0].Start < legacy[0].Start) {
+			refs = append(refs, uris[0])
+			uris = uris[1:]
+		} else {
+			refs = append(refs, legacy[0])
+			legacy = legacy[1:]
+		}
+	}
+	return refs
+}
+
+func tagReference(t []string) *Reference {
+	if len(t) < 2 {
+		return nil
+	}
+	var relays []string
+	if len(t) > 2 && t[2] != "" {
+		relays = []string{t[2]}
+	}
+	switch t[0] {
+	case "p":
+		return &Reference{Profile: &nip19.ProfilePointer{PubKey: t[1], Relays: relays}}
+	case "e":
+		return &Reference{Event: &nip19.EventPointer{ID: t[1], Relays: relays}}
+	case "a":
+		parts := strings.SplitN(t[1], ":", 3)
+		if len(parts) != 3 {
+			return nil
+		}
+		kind, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &Reference{Entity: &nip19.EntityPointer{
+			Kind:       kind,
+			PubKey:     parts[1],
+			Identifier: parts[2],
+			Relays:     relays,
+		}}
+	}
+	return nil
+}
+
+// Tags returns the tags an event should carry for the given references:
+// a p tag for each profile, a q tag for each event (NIP-18 quotes) and an
+// a tag for each address, plus p tags for any authors the pointers name.
+// Legacy references already point at existing tags and are skipped, as are
+// duplicates.
+func Tags(refs []*Reference) [][]string {
+	tags := [][]string{}
+	seen := map[string]bool{}
+	add := func(t ...string) {
+		key := t[0] + ":" + t[1]
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		tags = append(tags, t)
+	}
+	firstRelay := func(relays []string) string {
+		if len(relays) > 0 {
+			return relays[0]
+		}
+		return ""
+	}
+	for _, ref := range refs {
+		if ref.TagIndex >= 0 {
+			continue
+		}
+		switch {
+		case ref.Profile != nil:
+			add("p", ref.Profile.PubKey, firstRelay(ref.Profile.Relays))
+		case ref.Event != nil:
+			add("q", ref.Event.ID, firstRelay(ref.Event.Relays), ref.Event.Author)
+			if ref.Event.Author != "" {
+				add("p", ref.Event.Author, "")
+			}
+		case ref.Entity != nil:
+			coord := fmt.Sprintf("%d:%s:%s", ref.Entity.Kind, ref.Entity.PubKey, ref.Entity.Identifier)
+			add("a", coord, firstRelay(ref.Entity.Relays))
+			add("p", ref.Entity.PubKey, "")
+		}
+	}
+	for i, t := range tags {
+		for len(t) > 2 && t[len(t)-1] == "" {
+			t = t[:len(t)-1]
+		}
+		tags[i] = t
+	}
+	return tags
+}
+
+// AddTags appends the tags for every reference in e.Content that the event
+// doesn't already carry. It must be called before the event is signed.
+func AddTags(e *proto.Event) {
+	have := map[string]bool{}
+	for _, t := range e.Tags {
+		if len(t) >= 2 {
+			have[t[0]+":"+t[1]] = true
+		}
+	}
+	for _, t := range Tags(Parse(e.Content)) {
+		if have[t[0]+":"+t[1]] {
+			continue
+		}
+		e.Tags = append(e.Tags, t)
+	}
+}
@@ -0,0 +1,103 @@
+package nip21
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+var (
+	pk = strings.Repeat("ab", 32)
+	id = strings.Repeat("cd", 32)
+)
+
+func TestParse(t *testing.T) {
+	npub, _ := nip19.EncodePubKey(pk)
+	kind := int64(1)
+	nevent, _ := nip19.EncodeEvent(&nip19.EventPointer{ID: id, Relays: []string{"wss://r"}, Author: pk, Kind: &kind})
+	nsec := "nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5"
+
+	content := "hi nostr:" + npub + ", see nostr:" + nevent + ". nostr:" + nsec + " nostr:npub1bogus"
+	refs := Parse(content)
+	if len(refs) != 2 {
+		t.Fatalf("got %d refs", len(refs))
+	}
+	if refs[0].Profile == nil || refs[0].Profile.PubKey != pk {
+		t.Fatalf("first ref %+v", refs[0])
+	}
+	if content[refs[0].Start:refs[0].End] != "nostr:"+npub || refs[0].Text != "nostr:"+npub {
+		t.Fatal("bad offsets for first ref")
+	}
+	if refs[1].Event == nil || refs[1].Event.ID != id || content[refs[1].Start:refs[1].End] != "nostr:"+nevent {
+		t.Fatalf("second ref %+v", refs[1])
+	}
+
+	want := [][]string{
+		{"p", pk},
+		{"q", id, "wss://r", pk},
+	}
+	if got := Tags(refs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tags %v", got)
+	}
+}
+
+func TestParseEventLegacy(t *testing.T) {
+	naddr, _ := nip19.EncodeAddr(&nip19.EntityPointer{Identifier: "x", PubKey: pk, Kind: 30023})
+	e := &proto.Event{
+		Content: "#[1] wrote nostr:" + naddr + " #[0] #[5]",
+		Tags: [][]string{
+			{"e", id},
+			{"p", pk, "wss://r"},
+		},
+	}
+	refs := ParseEvent(e)
+	if len(refs) != 3 {
+		t.Fatalf("got %d refs", len(refs))
+	}
+	if refs[0].TagIndex != 1 || refs[0].Profile.PubKey != pk || refs[0].Profile.Relays[0] != "wss://r" || refs[0].Start != 0 || refs[0].End != 4 {
+		t.Fatalf("first ref %+v", refs[0])
+	}
+	if refs[1].Entity == nil || refs[1].Entity.Identifier != "x" {
+		t.Fatalf("second ref %+v", refs[1])
+	}
+	if refs[2].TagIndex != 0 || refs[2].Event.ID != id {
+		t.Fatalf("third ref %+v", refs[2])
+	}
+	want := [][]string{
+		{"a", "30023:" + pk + ":x"},
+		{"p", pk},
+	}
+	if got := Tags(refs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tags %v", got)
+	}
+}
+
+func TestAddTags(t *testing.T) {
+	npub, _ := nip19.EncodePubKey(pk)
+	note, _ := nip19.EncodeNote(id)
+	e := &proto.Event{
+		Content: "nostr:" + npub + " nostr:" + note + " nostr:" + npub,
+		Tags:    [][]string{{"p", pk}},
+	}
+	AddTags(e)
+	want := [][]string{{"p", pk}, {"q", id}}
+	if !reflect.DeepEqual(e.Tags, want) {
+		t.Fatalf("tags %v", e.Tags)
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	if _, err := ParseURI("npub1xyz"); err != ErrNotNostrURI {
+		t.Fatal(err)
+	}
+	if _, err := ParseURI("nostr:nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5"); err != ErrPrivateKeyURI {
+		t.Fatal(err)
+	}
+	npub, _ := nip19.EncodePubKey(pk)
+	if ref, err := ParseURI(EncodeURI(npub)); err != nil || ref.Profile.PubKey != pk {
+		t.Fatal(ref, err)
+	}
+}
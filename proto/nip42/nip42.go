@@ -0,0 +1,77 @@
+// Package nip42 builds and validates the kind 22242 events clients use to
+// authenticate to relays.
+package nip42
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+)
+
+const KindClientAuth = 22242
+
+// MaxAge is how far an auth event's created_at may be from now.
+const MaxAge = 10 * time.Minute
+
+var (
+	ErrWrongKind      = errors.New("auth: wrong event kind")
+	ErrBadSignature   = errors.New("auth: invalid signature")
+	ErrWrongChallenge = errors.New("auth: challenge mismatch")
+	ErrWrongRelay     = errors.New("auth: relay mismatch")
+	ErrExpired        = errors.New("auth: created_at too far from now")
+)
+
+// NewAuthEvent returns an unsigned auth event answering challenge.
+func NewAuthEvent(relayURL, challenge string) *proto.Event {
+	return &proto.Event{
+		Kind:      KindClientAuth,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			{"relay", relayURL},
+			{"challenge", challenge},
+		},
+		Content: "",
+	}
+}
+
+func tagValue(e *proto.Event, name string) string {
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == name {
+			return t[1]
+		}
+	}
+	return ""
+}
+
+func hostOf(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimSuffix(s, "/"))
+	}
+	return strings.ToLower(u.Host)
+}
+
+// Validate checks e against the challenge the relay issued and the host
+// the relay is being reached on, and returns the authenticated pubkey.
+func Validate(e *proto.Event, challenge, relayHost string) (string, error) {
+	if e.Kind != KindClientAuth {
+		return "", ErrWrongKind
+	}
+	if !e.CheckSig() {
+		return "", ErrBadSignature
+	}
+	if tagValue(e, "challenge") != challenge {
+		return "", ErrWrongChallenge
+	}
+	if hostOf(tagValue(e, "relay")) != hostOf(relayHost) {
+		return "", ErrWrongRelay
+	}
+	age := time.Since(time.Unix(e.CreatedAt, 0))
+	if age > MaxAge || age < -MaxAge {
+		return "", ErrExpired
+	}
+	return e.PubKey, nil
+}
@@ -0,0 +1,182 @@
+// Package nip44 implements version 2 of the NIP-44 encrypted payload
+// format: an HKDF derived conversation key, ChaCha20 with HMAC-SHA256 and
+// length-hiding padding.
+package nip44
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	Version = 2
+
+	MinPlaintextSize = 1
+	MaxPlaintextSize = 65535
+
+	minPayloadSize = 132
+	maxPayloadSize = 87472
+	minDataSize    = 99
+	maxDataSize    = 65603
+)
+
+var salt = []byte("nip44-v2")
+
+var (
+	ErrUnknownVersion       = errors.New("unknown nip44 version")
+	ErrInvalidPayloadLength = errors.New("invalid nip44 payload length")
+	ErrInvalidBase64        = errors.New("invalid nip44 base64")
+	ErrInvalidDataLength    = errors.New("invalid nip44 data length")
+	ErrInvalidMAC           = errors.New("invalid nip44 mac")
+	ErrInvalidPadding       = errors.New("invalid nip44 padding")
+	ErrInvalidPlaintextSize = errors.New("nip44 plaintext must be between 1 and 65535 bytes")
+	ErrInvalidKeySize       = errors.New("nip44 conversation key must be 32 bytes")
+)
+
+// ConversationKey derives the key shared between key and the hex public
+// key pubKey. It is symmetric: both sides derive the same value.
+func ConversationKey(key *secp256k1.PrivateKey, pubKey string) ([]byte, error) {
+	pk, err := common.ParsePubKeyHex(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf.Extract(sha256.New, common.SharedSecret(key, pk), salt), nil
+}
+
+func messageKeys(conversationKey, nonce []byte) (chachaKey, chachaNonce, hmacKey []byte, err error) {
+	if len(conversationKey) != 32 {
+		return nil, nil, nil, ErrInvalidKeySize
+	}
+	keys := make([]byte, 76)
+	_, err = io.ReadFull(hkdf.Expand(sha256.New, conversationKey, nonce), keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return keys[:32], keys[32:44], keys[44:], nil
+}
+
+// CalcPaddedLen returns the padded size of a plaintext of length n.
+func CalcPaddedLen(n int) int {
+	if n <= 32 {
+		return 32
+	}
+	nextPower := 1 << bits.Len(uint(n-1))
+	chunk := 32
+	if nextPower > 256 {
+		chunk = nextPower / 8
+	}
+	return chunk * ((n-1)/chunk + 1)
+}
+
+func pad(plaintext string) ([]byte, error) {
+	n := len(plaintext)
+	if n < MinPlaintextSize || n > MaxPlaintextSize {
+		return nil, ErrInvalidPlaintextSize
+	}
+	buf := make([]byte, 2+CalcPaddedLen(n))
+	binary.BigEndian.PutUint16(buf, uint16(n))
+	copy(buf[2:], plaintext)
+	return buf, nil
+}
+
+func unpad(padded []byte) (string, error) {
+	if len(padded) < 2 {
+		return "", ErrInvalidPadding
+	}
+	n := int(binary.BigEndian.Uint16(padded))
+	if n < MinPlaintextSize || len(padded) != 2+CalcPaddedLen(n) {
+		return "", ErrInvalidPadding
+	}
+	return string(padded[2 : 2+n]), nil
+}
+
+func mac(hmacKey, nonce, ciphertext []byte) []byte {
+	h := hmac.New(sha256.New, hmacKey)
+	h.Write(nonce)
+	h.Write(ciphertext)
+	return h.Sum(nil)
+}
+
+// Encrypt encrypts plaintext under a conversation key with a random nonce
+// and returns the base64 payload.
+func Encrypt(conversationKey []byte, plaintext string) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encrypt(conversationKey, nonce, plaintext)
+}
+
+func encrypt(conversationKey, nonce []byte, plaintext string) (string, error) {
+	chachaKey, chachaNonce, hmacKey, err := messageKeys(conversationKey, nonce)
+	if err != nil {
+		return "", err
+	}
+	padded, err := pad(plaintext)
+	if err != nil {
+		return "", err
+	}
+	c, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	c.XORKeyStream(padded, padded)
+
+	data := make([]byte, 0, 1+len(nonce)+len(padded)+sha256.Size)
+	data = append(data, Version)
+	data = append(data, nonce...)
+	data = append(data, padded...)
+	data = append(data, mac(hmacKey, nonce, padded)...)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt verifies and decrypts a base64 payload produced by Encrypt.
+func Decrypt(conversationKey []byte, payload string) (string, error) {
+	if len(payload) > 0 && payload[0] == '#' {
+		return "", ErrUnknownVersion
+	}
+	if len(payload) < minPayloadSize || len(payload) > maxPayloadSize {
+		return "", fmt.Errorf("%w: %d", ErrInvalidPayloadLength, len(payload))
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidBase64
+	}
+	if len(data) < minDataSize || len(data) > maxDataSize {
+		return "", fmt.Errorf("%w: %d", ErrInvalidDataLength, len(data))
+	}
+	if data[0] != Version {
+		return "", fmt.Errorf("%w: %d", ErrUnknownVersion, data[0])
+	}
+	nonce := data[1:33]
+	ciphertext := data[33 : len(data)-sha256.Size]
+	tag := data[len(data)-sha256.Size:]
+
+	chachaKey, chachaNonce, hmacKey, err := messageKeys(conversationKey, nonce)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare(tag, mac(hmacKey, nonce, ciphertext)) != 1 {
+		return "", ErrInvalidMAC
+	}
+	c, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	padded := make([]byte, len(ciphertext))
+	c.XORKeyStream(padded, ciphertext)
+	return unpad(padded)
+}
@@ -0,0 +1,202 @@
+package nip44
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto/nip19"
+)
+
+type vectors struct {
+	V2 struct {
+		Valid struct {
+			GetConversationKey []struct {
+				Sec1            string `json:"sec1"`
+				Pub2            string `json:"pub2"`
+				ConversationKey string `json:"conversation_key"`
+			} `json:"get_conversation_key"`
+			GetMessageKeys struct {
+				ConversationKey string `json:"conversation_key"`
+				Keys            []struct {
+					Nonce       string `json:"nonce"`
+					ChachaKey   string `json:"chacha_key"`
+					ChachaNonce string `json:"chacha_nonce"`
+					HMACKey     string `json:"hmac_key"`
+				} `json:"keys"`
+			} `json:"get_message_keys"`
+			CalcPaddedLen  [][2]int `json:"calc_padded_len"`
+			EncryptDecrypt []struct {
+				Sec1            string `json:"sec1"`
+				Sec2            string `json:"sec2"`
+				ConversationKey string `json:"conversation_key"`
+				Nonce           string `json:"nonce"`
+				Plaintext       string `json:"plaintext"`
+				Payload         string `json:"payload"`
+			} `json:"encrypt_decrypt"`
+			EncryptDecryptLongMsg []struct {
+				ConversationKey string `json:"conversation_key"`
+				Nonce           string `json:"nonce"`
+				Pattern         string `json:"pattern"`
+				Repeat          int    `json:"repeat"`
+				PlaintextSHA256 string `json:"plaintext_sha256"`
+				PayloadSHA256   string `json:"payload_sha256"`
+			} `json:"encrypt_decrypt_long_msg"`
+		} `json:"valid"`
+		Invalid struct {
+			EncryptMsgLengths  []int `json:"encrypt_msg_lengths"`
+			GetConversationKey []struct {
+				Sec1 string `json:"sec1"`
+				Pub2 string `json:"pub2"`
+				Note string `json:"note"`
+			} `json:"get_conversation_key"`
+			Decrypt []struct {
+				ConversationKey string `json:"conversation_key"`
+				Payload         string `json:"payload"`
+				Note            string `json:"note"`
+			} `json:"decrypt"`
+		} `json:"invalid"`
+	} `json:"v2"`
+}
+
+// vectorsSHA256 is the checksum of testdata/nip44.vectors.json, so that
+// a trimmed or edited copy fails rather than passing with fewer cases.
+// The file holds the paulmillr/nip44 v2 vectors but is not a byte for
+// byte copy of upstream's nip44.vectors.json, so this is not the checksum
+// NIP-44 publishes. TODO: replace the file with upstream's and pin the
+// published checksum here.
+const vectorsSHA256 = "b7fd14c4764c490961a02663c721ad9dfcfdfa2bf857f092b6516cb592bb0773"
+
+func loadVectors(t *testing.T) *vectors {
+	buf, err := os.ReadFile("testdata/nip44.vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := sha256.Sum256(buf); hex.EncodeToString(h[:]) != vectorsSHA256 {
+		t.Fatalf("vectors file has sha256 %x, want %s", h, vectorsSHA256)
+	}
+	v := &vectors{}
+	if err := json.Unmarshal(buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func conversationKey(sec1, pub2 string) ([]byte, error) {
+	key, err := nip19.DecodePrivateKey(sec1)
+	if err != nil {
+		return nil, err
+	}
+	return ConversationKey(key, pub2)
+}
+
+func TestConversationKey(t *testing.T) {
+	v := loadVectors(t)
+	for _, c := range v.V2.Valid.GetConversationKey {
+		ck, err := conversationKey(c.Sec1, c.Pub2)
+		if err != nil || hex.EncodeToString(ck) != c.ConversationKey {
+			t.Errorf("ConversationKey(%s, %s) = %x, %v", c.Sec1, c.Pub2, ck, err)
+		}
+	}
+	for _, c := range v.V2.Invalid.GetConversationKey {
+		if _, err := conversationKey(c.Sec1, c.Pub2); err == nil {
+			t.Errorf("ConversationKey(%s, %s) should fail: %s", c.Sec1, c.Pub2, c.Note)
+		}
+	}
+}
+
+func TestMessageKeys(t *testing.T) {
+	v := loadVectors(t)
+	ck := unhex(t, v.V2.Valid.GetMessageKeys.ConversationKey)
+	for _, c := range v.V2.Valid.GetMessageKeys.Keys {
+		key, nonce, hmacKey, err := messageKeys(ck, unhex(t, c.Nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key) != c.ChachaKey || hex.EncodeToString(nonce) != c.ChachaNonce || hex.EncodeToString(hmacKey) != c.HMACKey {
+			t.Errorf("messageKeys(%s) mismatch", c.Nonce)
+		}
+	}
+}
+
+func TestCalcPaddedLen(t *testing.T) {
+	v := loadVectors(t)
+	for _, c := range v.V2.Valid.CalcPaddedLen {
+		if got := CalcPaddedLen(c[0]); got != c[1] {
+			t.Errorf("CalcPaddedLen(%d) = %d, want %d", c[0], got, c[1])
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	v := loadVectors(t)
+	for _, c := range v.V2.Valid.EncryptDecrypt {
+		ck := unhex(t, c.ConversationKey)
+		sec2, err := nip19.DecodePrivateKey(c.Sec2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := conversationKey(c.Sec1, common.PubKeyHex(sec2.PubKey()))
+		if err != nil || !bytes.Equal(got, ck) {
+			t.Errorf("conversation key mismatch for %s", c.Sec1)
+		}
+		payload, err := encrypt(ck, unhex(t, c.Nonce), c.Plaintext)
+		if err != nil || payload != c.Payload {
+			t.Errorf("encrypt(%q) = %s, %v", c.Plaintext, payload, err)
+		}
+		pt, err := Decrypt(ck, c.Payload)
+		if err != nil || pt != c.Plaintext {
+			t.Errorf("Decrypt(%s) = %q, %v", c.Payload, pt, err)
+		}
+	}
+}
+
+func TestEncryptDecryptLong(t *testing.T) {
+	v := loadVectors(t)
+	for _, c := range v.V2.Valid.EncryptDecryptLongMsg {
+		ck := unhex(t, c.ConversationKey)
+		plaintext := strings.Repeat(c.Pattern, c.Repeat)
+		if h := sha256.Sum256([]byte(plaintext)); hex.EncodeToString(h[:]) != c.PlaintextSHA256 {
+			t.Fatal("plaintext hash mismatch")
+		}
+		payload, err := encrypt(ck, unhex(t, c.Nonce), plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := sha256.Sum256([]byte(payload)); hex.EncodeToString(h[:]) != c.PayloadSHA256 {
+			t.Errorf("payload hash mismatch for pattern %q", c.Pattern)
+		}
+		if pt, err := Decrypt(ck, payload); err != nil || pt != plaintext {
+			t.Errorf("round trip failed for pattern %q: %v", c.Pattern, err)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	v := loadVectors(t)
+	ck := make([]byte, 32)
+	for _, n := range v.V2.Invalid.EncryptMsgLengths {
+		if _, err := Encrypt(ck, strings.Repeat("a", n)); !errors.Is(err, ErrInvalidPlaintextSize) {
+			t.Errorf("Encrypt of %d bytes: %v", n, err)
+		}
+	}
+	for _, c := range v.V2.Invalid.Decrypt {
+		if _, err := Decrypt(unhex(t, c.ConversationKey), c.Payload); err == nil {
+			t.Errorf("Decrypt should fail: %s", c.Note)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package nip49 encrypts private keys with a password as bech32
+// "ncryptsec" strings.
+package nip49
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/andyleap/nostr/proto/nip19"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+const Prefix = "ncryptsec"
+
+const version = 0x02
+
+// DefaultLogN is the scrypt cost used when none is given: 2^16 rounds,
+// which takes about 64MiB and a fraction of a second.
+const DefaultLogN = 16
+
+// KeySecurity records whether the key was ever handled insecurely before
+// it was encrypted. It is authenticated along with the key.
+type KeySecurity byte
+
+const (
+	KeyInsecure        KeySecurity = 0x00
+	KeySecure          KeySecurity = 0x01
+	KeySecurityUnknown KeySecurity = 0x02
+)
+
+var (
+	ErrInvalid         = errors.New("nip49: invalid ncryptsec")
+	ErrVersion         = errors.New("nip49: unsupported version")
+	ErrWrongPassword   = errors.New("nip49: wrong password or corrupt data")
+	ErrBadKeySecurity  = errors.New("nip49: invalid key security byte")
+	ErrLogNOutOfBounds = errors.New("nip49: log_n out of range")
+)
+
+func deriveKey(password string, salt []byte, logN uint8) ([]byte, error) {
+	if logN == 0 || logN > 22 {
+		return nil, ErrLogNOutOfBounds
+	}
+	return scrypt.Key([]byte(norm.NFKC.String(password)), salt, 1<<logN, 8, 1, 32)
+}
+
+// Encrypt encrypts key with password. logN is the scrypt cost as a power
+// of two; use DefaultLogN unless there's a reason not to.
+func Encrypt(key *secp256k1.PrivateKey, password string, logN uint8, ks KeySecurity) (string, error) {
+	if ks > KeySecurityUnknown {
+		return "", ErrBadKeySecurity
+	}
+	var salt [16]byte
+	var nonce [chacha20poly1305.NonceSizeX]byte
+	_, err := rand.Read(salt[:])
+	if err != nil {
+		return "", err
+	}
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		return "", err
+	}
+	return encrypt(key, password, logN, ks, salt[:], nonce[:])
+}
+
+func encrypt(key *secp256k1.PrivateKey, password string, logN uint8, ks KeySecurity, salt, nonce []byte) (string, error) {
+	symKey, err := deriveKey(password, salt, logN)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(symKey)
+	if err != nil {
+		return "", err
+	}
+	ad := []byte{byte(ks)}
+	buf := make([]byte, 0, 91)
+	buf = append(buf, version, logN)
+	buf = append(buf, salt...)
+	buf = append(buf, nonce...)
+	buf = append(buf, ad...)
+	buf = aead.Seal(buf, nonce, key.Serialize(), ad)
+	return nip19.EncodeBytes(Prefix, buf)
+}
+
+// Decrypt decrypts an ncryptsec string with password.
+func Decrypt(s string, password string) (*secp256k1.PrivateKey, KeySecurity, error) {
+	hrp, buf, err := nip19.DecodeBytes(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	if hrp != Prefix || len(buf) != 91 {
+		return nil, 0, ErrInvalid
+	}
+	if buf[0] != version {
+		return nil, 0, ErrVersion
+	}
+	logN := buf[1]
+	salt := buf[2:18]
+	nonce := buf[18:42]
+	ad := buf[42:43]
+	if KeySecurity(ad[0]) > KeySecurityUnknown {
+		return nil, 0, ErrBadKeySecurity
+	}
+	symKey, err := deriveKey(password, salt, logN)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := chacha20poly1305.NewX(symKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	pt, err := aead.Open(nil, nonce, buf[43:], ad)
+	if err != nil {
+		return nil, 0, ErrWrongPassword
+	}
+	return secp256k1.PrivKeyFromBytes(pt), KeySecurity(ad[0]), nil
+}
@@ -0,0 +1,40 @@
+package nip49
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+)
+
+func TestDecryptVector(t *testing.T) {
+	key, ks, err := Decrypt("ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p", "nostr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(key.Serialize()) != "3501454135014541350145413501453fefb02227e449e57cf4d3a3ce05378683" {
+		t.Fatal(hex.EncodeToString(key.Serialize()))
+	}
+	if ks != KeyInsecure {
+		t.Fatal(ks)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	// the angstrom and ohm signs normalize to Å and Ω
+	s, err := Encrypt(key, "\u212b\u2126", 4, KeySecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ks, err := Decrypt(s, "\u00c5\u03a9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Key.Equals(&key.Key) || ks != KeySecure {
+		t.Fatal("round trip mismatch")
+	}
+	if _, _, err := Decrypt(s, "wrong"); err != ErrWrongPassword {
+		t.Fatal(err)
+	}
+}
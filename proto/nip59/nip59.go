@@ -0,0 +1,242 @@
+// Package nip59 implements gift wrapping: an unsigned rumor is sealed
+// (kind 13) by its author for a recipient, and the seal is wrapped
+// (kind 1059) with a single-use key so that relays only learn the
+// recipient.
+package nip59
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip44"
+	"github.com/andyleap/nostr/signer"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+const (
+	KindSeal     = 13
+	KindGiftWrap = 1059
+)
+
+// MaxTimeSkew is how far into the past seal and wrap timestamps are
+// randomized.
+const MaxTimeSkew = 2 * 24 * time.Hour
+
+var (
+	ErrWrongKind    = errors.New("nip59: wrong event kind")
+	ErrBadSignature = errors.New("nip59: invalid signature")
+	ErrAuthorForged = errors.New("nip59: rumor author does not match seal")
+	ErrBadRumorID   = errors.New("nip59: rumor id does not match content")
+	ErrSignedRumor  = errors.New("nip59: rumor must not be signed")
+	ErrNoRecipient  = errors.New("nip59: gift wrap has no p tag")
+	ErrSealHasTags  = errors.New("nip59: seal must not have tags")
+	ErrNotRecipient = errors.New("nip59: gift wrap is for another key")
+)
+
+func randomTime() int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(MaxTimeSkew/time.Second)))
+	if err != nil {
+		return time.Now().Unix()
+	}
+	return time.Now().Unix() - n.Int64()
+}
+
+// rumor is an event without a signature, which is how rumors are encoded.
+type rumor struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int64      `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+}
+
+// NewRumor returns a copy of e authored by pubKey with its id set and no
+// signature.
+func NewRumor(e *proto.Event, pubKey string) *proto.Event {
+	r := *e
+	r.PubKey = pubKey
+	if r.Tags == nil {
+		r.Tags = [][]string{}
+	}
+	if r.CreatedAt == 0 {
+		r.CreatedAt = time.Now().Unix()
+	}
+	r.Sig = ""
+	r.ID = r.CalcID()
+	return &r
+}
+
+func encryptJSON(key *secp256k1.PrivateKey, recipient string, v interface{}) (string, error) {
+	ck, err := nip44.ConversationKey(key, recipient)
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Encrypt(ck, string(buf))
+}
+
+func decryptJSON(ctx context.Context, s signer.Signer, sender string, content string, v interface{}) error {
+	pt, err := s.Nip44Decrypt(ctx, sender, content)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(pt), v)
+}
+
+// Seal encrypts the rumor for recipient in a kind 13 event signed by s.
+// The rumor's pubkey and id are set from s.
+func Seal(ctx context.Context, s signer.Signer, e *proto.Event, recipient string) (*proto.Event, error) {
+	pubKey, err := s.GetPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRumor(e, pubKey)
+	buf, err := json.Marshal(&rumor{
+		ID:        r.ID,
+		PubKey:    r.PubKey,
+		CreatedAt: r.CreatedAt,
+		Kind:      r.Kind,
+		Tags:      r.Tags,
+		Content:   r.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.Nip44Encrypt(ctx, recipient, string(buf))
+	if err != nil {
+		return nil, err
+	}
+	seal := &proto.Event{
+		Kind:      KindSeal,
+		CreatedAt: randomTime(),
+		Tags:      [][]string{},
+		Content:   content,
+	}
+	err = s.SignEvent(ctx, seal)
+	if err != nil {
+		return nil, err
+	}
+	return seal, nil
+}
+
+// Wrap encrypts a seal for recipient in a kind 1059 event signed by a
+// freshly generated key.
+func Wrap(seal *proto.Event, recipient string) (*proto.Event, error) {
+	ephemeral := common.GeneratePrivateKey()
+	content, err := encryptJSON(ephemeral, recipient, seal)
+	if err != nil {
+		return nil, err
+	}
+	wrap := &proto.Event{
+		Kind:      KindGiftWrap,
+		CreatedAt: randomTime(),
+		Tags: [][]string{
+			{"p", recipient},
+		},
+		Content: content,
+	}
+	err = wrap.Sign(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	return wrap, nil
+}
+
+// GiftWrap seals and wraps a rumor for recipient.
+func GiftWrap(ctx context.Context, s signer.Signer, e *proto.Event, recipient string) (*proto.Event, error) {
+	seal, err := Seal(ctx, s, e, recipient)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(seal, recipient)
+}
+
+// Recipient returns the p tag of a gift wrap.
+func Recipient(wrap *proto.Event) (string, error) {
+	for _, t := range wrap.Tags {
+		if len(t) >= 2 && t[0] == "p" {
+			return t[1], nil
+		}
+	}
+	return "", ErrNoRecipient
+}
+
+// Unwrap decrypts a gift wrap addressed to s and returns the verified
+// seal inside it.
+func Unwrap(ctx context.Context, s signer.Signer, wrap *proto.Event) (*proto.Event, error) {
+	if wrap.Kind != KindGiftWrap {
+		return nil, ErrWrongKind
+	}
+	if !wrap.CheckSig() {
+		return nil, ErrBadSignature
+	}
+	recipient, err := Recipient(wrap)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := s.GetPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if recipient != pubKey {
+		return nil, ErrNotRecipient
+	}
+	seal := &proto.Event{}
+	err = decryptJSON(ctx, s, wrap.PubKey, wrap.Content, seal)
+	if err != nil {
+		return nil, err
+	}
+	if seal.Kind != KindSeal {
+		return nil, ErrWrongKind
+	}
+	if len(seal.Tags) != 0 {
+		return nil, ErrSealHasTags
+	}
+	if !seal.CheckSig() {
+		return nil, ErrBadSignature
+	}
+	return seal, nil
+}
+
+// Unseal decrypts a seal and returns the rumor, checking that the rumor
+// claims the seal's author and that its id is consistent.
+func Unseal(ctx context.Context, s signer.Signer, seal *proto.Event) (*proto.Event, error) {
+	if seal.Kind != KindSeal {
+		return nil, ErrWrongKind
+	}
+	r := &proto.Event{}
+	err := decryptJSON(ctx, s, seal.PubKey, seal.Content, r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Sig != "" {
+		return nil, ErrSignedRumor
+	}
+	if r.PubKey != seal.PubKey {
+		return nil, ErrAuthorForged
+	}
+	if r.ID != r.CalcID() {
+		return nil, ErrBadRumorID
+	}
+	return r, nil
+}
+
+// Open unwraps and unseals a gift wrap, returning the rumor. The rumor's
+// PubKey is the authenticated sender.
+func Open(ctx context.Context, s signer.Signer, wrap *proto.Event) (*proto.Event, error) {
+	seal, err := Unwrap(ctx, s, wrap)
+	if err != nil {
+		return nil, err
+	}
+	return Unseal(ctx, s, seal)
+}
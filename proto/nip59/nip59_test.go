@@ -0,0 +1,61 @@
+package nip59
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/signer"
+)
+
+func TestGiftWrap(t *testing.T) {
+	alice := common.GeneratePrivateKey()
+	bob := common.GeneratePrivateKey()
+	bobPK := common.PubKeyHex(bob.PubKey())
+
+	e := &proto.Event{Kind: 1, Content: "secret", Tags: [][]string{{"p", bobPK}}}
+	ctx := context.Background()
+	wrap, err := GiftWrap(ctx, signer.NewKeySigner(alice), e, bobPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap.Kind != KindGiftWrap || wrap.PubKey == common.PubKeyHex(alice.PubKey()) || !wrap.CheckSig() {
+		t.Fatalf("bad wrap %+v", wrap)
+	}
+	if _, err := Open(ctx, signer.NewKeySigner(alice), wrap); err != ErrNotRecipient {
+		t.Fatal("sender should not be able to open a wrap for bob", err)
+	}
+	r, err := Open(ctx, signer.NewKeySigner(bob), wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "secret" || r.PubKey != common.PubKeyHex(alice.PubKey()) || r.Sig != "" || r.ID != r.CalcID() {
+		t.Fatalf("bad rumor %+v", r)
+	}
+	if e.PubKey != "" || e.ID != "" {
+		t.Fatal("input event was modified")
+	}
+}
+
+func TestForgedAuthor(t *testing.T) {
+	alice := common.GeneratePrivateKey()
+	mallory := common.GeneratePrivateKey()
+	bob := common.GeneratePrivateKey()
+	bobPK := common.PubKeyHex(bob.PubKey())
+
+	r := NewRumor(&proto.Event{Kind: 14, Content: "from alice, honest"}, common.PubKeyHex(alice.PubKey()))
+	content, err := encryptJSON(mallory, bobPK, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal := &proto.Event{Kind: KindSeal, Tags: [][]string{}, Content: content}
+	seal.Sign(mallory)
+	wrap, err := Wrap(seal, bobPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(context.Background(), signer.NewKeySigner(bob), wrap); err != ErrAuthorForged {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+package proto
+
+import (
+	"strconv"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s as a JSON string using the NIP-01 escaping
+// rules: only the quote, backslash and control characters are escaped,
+// everything else (including <, >, & and U+2028/2029) is written raw.
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
+		}
+		buf = append(buf, s[start:i]...)
+		switch c {
+		case '"':
+			buf = append(buf, '\\', '"')
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		default:
+			buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		}
+		start = i + 1
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
+
+func appendTags(buf []byte, tags [][]string) []byte {
+	buf = append(buf, '[')
+	for i, t := range tags {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '[')
+		for j, v := range t {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendString(buf, v)
+		}
+		buf = append(buf, ']')
+	}
+	return append(buf, ']')
+}
+
+// Serialize returns the canonical NIP-01 serialization the event id is
+// the hash of: [0,<pubkey>,<created_at>,<kind>,<tags>,<content>].
+func (e *Event) Serialize() []byte {
+	buf := make([]byte, 0, 100+len(e.Content))
+	buf = append(buf, "[0,"...)
+	buf = appendString(buf, e.PubKey)
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, e.CreatedAt, 10)
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, e.Kind, 10)
+	buf = append(buf, ',')
+	buf = appendTags(buf, e.Tags)
+	buf = append(buf, ',')
+	buf = appendString(buf, e.Content)
+	return append(buf, ']')
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 300+len(e.Content))
+	buf = append(buf, `{"id":`...)
+	buf = appendString(buf, e.ID)
+	buf = append(buf, `,"pubkey":`...)
+	buf = appendString(buf, e.PubKey)
+	buf = append(buf, `,"created_at":`...)
+	buf = strconv.AppendInt(buf, e.CreatedAt, 10)
+	buf = append(buf, `,"kind":`...)
+	buf = strconv.AppendInt(buf, e.Kind, 10)
+	buf = append(buf, `,"tags":`...)
+	buf = appendTags(buf, e.Tags)
+	buf = append(buf, `,"content":`...)
+	buf = appendString(buf, e.Content)
+	buf = append(buf, `,"sig":`...)
+	buf = appendString(buf, e.Sig)
+	return append(buf, '}'), nil
+}
@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// generated with JSON.stringify([0, pubkey, created_at, kind, tags, content])
+// and sha256 in node
+var serializeVectors = []struct {
+	event, serialized, id string
+}{
+	{
+		`{"pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000000,"kind":1,"tags":[],"content":"hello <b>world</b> & friends"}`,
+		"[0,\"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798\",1700000000,1,[],\"hello <b>world</b> & friends\"]",
+		"53aa7082809bbc6ab2ae0a76a3bb1dfc8164d73f15bf33494c2d196cbed99d5c",
+	},
+	{
+		`{"pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000001,"kind":1,"tags":[["p","x<y>&z"]],"content":"line\u2028sep\u2029para"}`,
+		"[0,\"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798\",1700000001,1,[[\"p\",\"x<y>&z\"]],\"line\u2028sep\u2029para\"]",
+		"e457843e01b58e23926c0c87f1b42e990e2d7e449fdd86f1b9dbe0bbcb454352",
+	},
+	{
+		`{"pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000002,"kind":1,"tags":[],"content":"quote\" backslash\\ nl\n cr\r tab\t bs\b ff\f"}`,
+		"[0,\"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798\",1700000002,1,[],\"quote\\\" backslash\\\\ nl\\n cr\\r tab\\t bs\\b ff\\f\"]",
+		"048bb92e9d87bf97d6ad372e280f247c9548b275ef7481faaa8a1d22d3933cee",
+	},
+	{
+		`{"pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000003,"kind":1,"tags":[["t","\u0000\u0001\u001f\u007f"]],"content":"ctl \u0000\u0001\u000b\u001f del\u007f"}`,
+		"[0,\"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798\",1700000003,1,[[\"t\",\"\\u0000\\u0001\\u001f\u007f\"]],\"ctl \\u0000\\u0001\\u000b\\u001f del\u007f\"]",
+		"f042aad42a9307193fa57c6896f00f51d14872ee76ad9d834118a93345acb135",
+	},
+	{
+		`{"pubkey":"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798","created_at":1700000004,"kind":30023,"tags":[["d","ünïcødé"],["e","","wss://r"]],"content":"emoji 🤙 cjk 漢字 / slash"}`,
+		"[0,\"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798\",1700000004,30023,[[\"d\",\"ünïcødé\"],[\"e\",\"\",\"wss://r\"]],\"emoji \U0001f919 cjk 漢字 / slash\"]",
+		"548f578c9a54e364acc80ca6fbb0c2989830a5979121a47517224c821e1853a7",
+	},
+}
+
+func TestSerialize(t *testing.T) {
+	for _, v := range serializeVectors {
+		e := &Event{}
+		if err := json.Unmarshal([]byte(v.event), e); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(e.Serialize()); got != v.serialized {
+			t.Errorf("serialized %q, want %q", got, v.serialized)
+		}
+		if id := e.CalcID(); id != v.id {
+			t.Errorf("id %s, want %s", id, v.id)
+		}
+
+		e.ID = v.id
+		buf, err := e.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		back := &Event{}
+		if err := json.Unmarshal(buf, back); err != nil {
+			t.Fatal(err)
+		}
+		if back.CalcID() != v.id || back.ID != v.id {
+			t.Errorf("round trip changed event: %s", buf)
+		}
+	}
+}
+
+func TestSerializeNilTags(t *testing.T) {
+	e := &Event{PubKey: "abc", CreatedAt: 1, Kind: 1}
+	if got := string(e.Serialize()); got != `[0,"abc",1,1,[],""]` {
+		t.Fatal(got)
+	}
+	buf, _ := json.Marshal(e)
+	if want := `{"id":"","pubkey":"abc","created_at":1,"kind":1,"tags":[],"content":"","sig":""}`; string(buf) != want {
+		t.Fatal(string(buf))
+	}
+}
@@ -0,0 +1,100 @@
+package proto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// MaxKind is the largest kind NIP-01 allows.
+const MaxKind = 65535
+
+var (
+	ErrInvalidID        = errors.New("malformed event id")
+	ErrIDMismatch       = errors.New("event id does not match content")
+	ErrInvalidPubKey    = errors.New("malformed pubkey")
+	ErrInvalidSig       = errors.New("malformed signature")
+	ErrBadSig           = errors.New("signature verification failed")
+	ErrInvalidKind      = errors.New("kind out of range")
+	ErrInvalidCreatedAt = errors.New("negative created_at")
+	ErrInvalidTag       = errors.New("malformed tag")
+)
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckFormat checks the event's fields are well formed: lowercase hex
+// id, pubkey and sig of the right lengths, a kind in range, a
+// non-negative created_at and no empty tags. It doesn't hash or verify
+// anything.
+func (e *Event) CheckFormat() error {
+	if !isLowerHex(e.ID, 64) {
+		return ErrInvalidID
+	}
+	if !isLowerHex(e.PubKey, 64) {
+		return ErrInvalidPubKey
+	}
+	if !isLowerHex(e.Sig, 128) {
+		return ErrInvalidSig
+	}
+	if e.Kind < 0 || e.Kind > MaxKind {
+		return fmt.Errorf("%w: %d", ErrInvalidKind, e.Kind)
+	}
+	if e.CreatedAt < 0 {
+		return ErrInvalidCreatedAt
+	}
+	for i, t := range e.Tags {
+		if len(t) == 0 {
+			return fmt.Errorf("%w: tag %d is empty", ErrInvalidTag, i)
+		}
+	}
+	return nil
+}
+
+// Validate checks the event's format, id and signature, returning one of
+// the errors above wrapped with details where useful.
+func (e *Event) Validate() error {
+	return e.validate(parsePubKey, true)
+}
+
+func parsePubKey(pk string) (*secp256k1.PublicKey, error) {
+	return schnorr.ParsePubKey(must(hex.DecodeString(pk)))
+}
+
+func (e *Event) validate(parseKey func(string) (*secp256k1.PublicKey, error), checkSig bool) error {
+	err := e.CheckFormat()
+	if err != nil {
+		return err
+	}
+	if e.CalcID() != e.ID {
+		return ErrIDMismatch
+	}
+	if !checkSig {
+		return nil
+	}
+	key, err := parseKey(e.PubKey)
+	if err != nil {
+		return ErrInvalidPubKey
+	}
+	sig, err := schnorr.ParseSignature(must(hex.DecodeString(e.Sig)))
+	if err != nil {
+		return ErrInvalidSig
+	}
+	if !sig.Verify(must(hex.DecodeString(e.ID)), key) {
+		return ErrBadSig
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package proto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+)
+
+func TestValidate(t *testing.T) {
+	key := common.GeneratePrivateKey()
+	for _, v := range []struct {
+		name   string
+		modify func(e *Event)
+		err    error
+	}{
+		{"valid", func(e *Event) {}, nil},
+		{"short id", func(e *Event) { e.ID = e.ID[:62] }, ErrInvalidID},
+		{"uppercase pubkey", func(e *Event) { e.PubKey = strings.ToUpper(e.PubKey) }, ErrInvalidPubKey},
+		{"non hex sig", func(e *Event) { e.Sig = "zz" + e.Sig[2:] }, ErrInvalidSig},
+		{"negative kind", func(e *Event) { e.Kind = -1 }, ErrInvalidKind},
+		{"empty tag", func(e *Event) { e.Tags = append(e.Tags, []string{}) }, ErrInvalidTag},
+		{"changed content", func(e *Event) { e.Content = "changed" }, ErrIDMismatch},
+		{"other sig", func(e *Event) {
+			o := &Event{Kind: 1, Content: "other"}
+			o.Sign(key)
+			e.Sig = o.Sig
+		}, ErrBadSig},
+	} {
+		e := &Event{Kind: 1, Content: "hello", Tags: [][]string{{"t", "test"}}}
+		e.Sign(key)
+		v.modify(e)
+		if err := e.Validate(); !errors.Is(err, v.err) {
+			t.Errorf("%s: got %v, want %v", v.name, err, v.err)
+		}
+	}
+}
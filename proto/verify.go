@@ -0,0 +1,94 @@
+package proto
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// maxCachedKeys bounds the Verifier's parsed key cache, which is reset
+// when it fills.
+const maxCachedKeys = 10000
+
+// Verifier validates many events at once, spreading the work across
+// cores and caching parsed public keys for authors seen repeatedly. It
+// is safe for concurrent use and worth keeping around between batches.
+// The zero value is ready to use.
+type Verifier struct {
+	// Workers is the number of goroutines verifying, GOMAXPROCS if zero.
+	Workers int
+	// Known, if set, returns the signatures of those of ids that have
+	// already been verified, such as events already in a store. An event
+	// carrying the same signature as its known copy has its format and id
+	// checked but not its signature, which the id doesn't cover.
+	Known func(ids []string) map[string]string
+
+	mu   sync.Mutex
+	keys map[string]*secp256k1.PublicKey
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{}
+}
+
+func (v *Verifier) parseKey(pk string) (*secp256k1.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[pk]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	key, err := parsePubKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	if v.keys == nil || len(v.keys) >= maxCachedKeys {
+		v.keys = map[string]*secp256k1.PublicKey{}
+	}
+	v.keys[pk] = key
+	v.mu.Unlock()
+	return key, nil
+}
+
+// Verify validates events, returning the result of Validate for each in
+// the same order.
+func (v *Verifier) Verify(events []*Event) []error {
+	errs := make([]error, len(events))
+	var known map[string]string
+	if v.Known != nil {
+		ids := make([]string, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		known = v.Known(ids)
+	}
+
+	workers := v.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(events) {
+		workers = len(events)
+	}
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				e := events[i]
+				sig, ok := known[e.ID]
+				errs[i] = e.validate(v.parseKey, !ok || sig != e.Sig)
+			}
+		}()
+	}
+	for i := range events {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,90 @@
+package proto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func signedEvents(n int) []*Event {
+	keys := []*secp256k1.PrivateKey{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, common.GeneratePrivateKey())
+	}
+	events := make([]*Event, n)
+	for i := range events {
+		events[i] = &Event{Kind: 1, CreatedAt: int64(i), Content: common.RandID()}
+		events[i].Sign(keys[i%len(keys)])
+	}
+	return events
+}
+
+func TestVerifier(t *testing.T) {
+	events := signedEvents(50)
+	events[3].Content = "tampered"
+	sig7 := events[7].Sig
+	events[7].Sig = events[8].Sig
+	events[9].Kind = -1
+
+	// the zero value needs no constructor
+	v := &Verifier{Workers: 4}
+	errs := v.Verify(events)
+	for i, err := range errs {
+		var want error
+		switch i {
+		case 3:
+			want = ErrIDMismatch
+		case 7:
+			want = ErrBadSig
+		case 9:
+			want = ErrInvalidKind
+		}
+		if (want == nil) != (err == nil) || want != nil && !errors.Is(err, want) {
+			t.Errorf("event %d: got %v, want %v", i, err, want)
+		}
+	}
+
+	// known events only have their ids checked, unless their signature
+	// differs from the known copy's
+	v.Known = func(ids []string) map[string]string {
+		return map[string]string{events[7].ID: events[7].Sig, events[3].ID: events[3].Sig}
+	}
+	errs = v.Verify(events)
+	if errs[7] != nil || errs[3] != ErrIDMismatch {
+		t.Fatal(errs[7], errs[3])
+	}
+	v.Known = func(ids []string) map[string]string {
+		return map[string]string{events[7].ID: sig7}
+	}
+	errs = v.Verify(events)
+	if !errors.Is(errs[7], ErrBadSig) {
+		t.Fatal(errs[7])
+	}
+}
+
+func BenchmarkCheckSig(b *testing.B) {
+	events := signedEvents(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, e := range events {
+			if !e.CheckSig() {
+				b.Fatal("invalid")
+			}
+		}
+	}
+}
+
+func BenchmarkVerifier(b *testing.B) {
+	events := signedEvents(1000)
+	v := NewVerifier()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, err := range v.Verify(events) {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
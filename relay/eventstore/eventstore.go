@@ -1,16 +1,33 @@
 package eventstore
 
 import (
+	"context"
+	"errors"
+	"sort"
+
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
 )
 
+// EventStore stores events. Get returns the events matching any of its
+// filters newest first, each filter returning at most its Limit events,
+// or all of them if Limit is 0. Calls stop with the context's error when
+// it is cancelled. Add returns ErrDuplicate for an event that is already
+// stored, and ErrSuperseded for one a stored event replaces.
 type EventStore interface {
-	Add(e *proto.Event) error
-	Get(filters ...*comm.Filter) ([]*proto.Event, error)
-	Delete(*comm.Filter) error
+	Add(ctx context.Context, e *proto.Event) error
+	Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error)
+	Delete(ctx context.Context, f *comm.Filter) error
 }
 
+// ErrDuplicate and ErrSuperseded are returned by Add for events it
+// doesn't store because it already has them, or a newer version of them.
+// Their text is fit for an OK message.
+var (
+	ErrDuplicate  = errors.New("duplicate: already have this event")
+	ErrSuperseded = errors.New("duplicate: already have a newer version of this event")
+)
+
 type FilterMethod int
 
 const (
@@ -24,3 +41,72 @@ type StoreFilterer interface {
 	//AddFilter adds a filter that allows greater control over how events are stored
 	AddFilter(func(e *proto.Event) (FilterMethod, *comm.Filter))
 }
+
+// Replace handles FilterMethodSingle for stores: it deletes the events
+// matching f that e replaces, so that e can be stored. If e is already
+// stored it returns ErrDuplicate, and if a newer event is ErrSuperseded.
+// Ties go to the lowest id, as NIP-01 says.
+func Replace(ctx context.Context, s EventStore, e *proto.Event, f *comm.Filter) error {
+	existing, err := s.Get(ctx, f)
+	if err != nil {
+		return err
+	}
+	for _, old := range existing {
+		if old.ID == e.ID {
+			return ErrDuplicate
+		}
+		if old.CreatedAt > e.CreatedAt || old.CreatedAt == e.CreatedAt && old.ID < e.ID {
+			return ErrSuperseded
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	return s.Delete(ctx, f)
+}
+
+// KnownSigs returns a function giving the signatures of those of ids
+// already in s, for use as proto.Verifier's Known. Its queries use ctx.
+func KnownSigs(ctx context.Context, s EventStore) func(ids []string) map[string]string {
+	return func(ids []string) map[string]string {
+		known := map[string]string{}
+		if len(ids) == 0 {
+			return known
+		}
+		events, err := s.Get(ctx, &comm.Filter{IDs: ids, Limit: int64(len(ids))})
+		if err != nil {
+			return known
+		}
+		for _, e := range events {
+			known[e.ID] = e.Sig
+		}
+		return known
+	}
+}
+
+// Sort orders events newest first, ties in id order.
+func Sort(events []*proto.Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt > events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+// Merge combines the results of querying several filters, dropping
+// duplicates, in Sort order.
+func Merge(results ...[]*proto.Event) []*proto.Event {
+	seen := map[string]bool{}
+	ret := []*proto.Event{}
+	for _, events := range results {
+		for _, e := range events {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				ret = append(ret, e)
+			}
+		}
+	}
+	Sort(ret)
+	return ret
+}
@@ -0,0 +1,519 @@
+// Package eventstoretest is a conformance suite for eventstore.EventStore
+// implementations. Call Run from a test in the store's package:
+//
+//	func TestConformance(t *testing.T) {
+//		eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+//			return memory.New()
+//		})
+//	}
+//
+// Expected results come from comm.Filter.Match, so a store passes if it
+// agrees with it.
+package eventstoretest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/nips/nip16"
+	"github.com/andyleap/nostr/relay/nips/nip33"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Run runs the suite, calling newStore for an empty store for each test.
+// Stores that need closing should do it with t.Cleanup.
+func Run(t *testing.T, newStore func(t *testing.T) eventstore.EventStore) {
+	for _, test := range []struct {
+		name string
+		f    func(t *testing.T, s eventstore.EventStore)
+	}{
+		{"Filters", testFilters},
+		{"MultipleFilters", testMultipleFilters},
+		{"LimitAndOrder", testLimitAndOrder},
+		{"Duplicates", testDuplicates},
+		{"Delete", testDelete},
+		{"Replaceable", testReplaceable},
+		{"Stream", testStream},
+		{"Context", testContext},
+		{"Concurrent", testConcurrent},
+		{"Large", testLarge},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.f(t, newStore(t))
+		})
+	}
+}
+
+var (
+	keys     []*secp256k1.PrivateKey
+	keysOnce sync.Once
+)
+
+func testKeys() []*secp256k1.PrivateKey {
+	keysOnce.Do(func() {
+		for i := 0; i < 4; i++ {
+			keys = append(keys, common.GeneratePrivateKey())
+		}
+	})
+	return keys
+}
+
+func pubKey(k *secp256k1.PrivateKey) string {
+	return common.PubKeyHex(k.PubKey())
+}
+
+func sign(t testing.TB, k *secp256k1.PrivateKey, e *proto.Event) *proto.Event {
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	err := e.Sign(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func add(t testing.TB, s eventstore.EventStore, events ...*proto.Event) {
+	t.Helper()
+	for _, e := range events {
+		err := s.Add(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expected returns what a store holding events should return for filters.
+func expected(events []*proto.Event, filters ...*comm.Filter) []*proto.Event {
+	var results [][]*proto.Event
+	for _, f := range filters {
+		var matched []*proto.Event
+		for _, e := range events {
+			if f.Match(e) {
+				matched = append(matched, e)
+			}
+		}
+		eventstore.Sort(matched)
+		if f.Limit > 0 && int64(len(matched)) > f.Limit {
+			matched = matched[:f.Limit]
+		}
+		results = append(results, matched)
+	}
+	return eventstore.Merge(results...)
+}
+
+func describe(events []*proto.Event) string {
+	s := "["
+	for i, e := range events {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%d:%s", e.CreatedAt, e.ID[:8])
+	}
+	return s + "]"
+}
+
+// check queries s and compares the result with want, in order.
+func check(t testing.TB, s eventstore.EventStore, want []*proto.Event, filters ...*comm.Filter) {
+	t.Helper()
+	got, err := s.Get(context.Background(), filters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %s, want %d %s", len(got), describe(got), len(want), describe(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("got %s, want %s", describe(got), describe(want))
+		}
+		if got[i].Content != want[i].Content || got[i].Sig != want[i].Sig || len(got[i].Tags) != len(want[i].Tags) {
+			t.Fatalf("event %s came back changed", got[i].ID)
+		}
+	}
+}
+
+// checkMatch compares s against Filter.Match over events.
+func checkMatch(t testing.TB, s eventstore.EventStore, events []*proto.Event, filters ...*comm.Filter) {
+	t.Helper()
+	check(t, s, expected(events, filters...), filters...)
+}
+
+// dataset is a small set of events covering every filter field. They
+// share created_at in pairs, so limits cut between events that only their
+// ids order.
+func dataset(t testing.TB) []*proto.Event {
+	k := testKeys()
+	var events []*proto.Event
+	for i := 0; i < 12; i++ {
+		e := &proto.Event{
+			Kind:      []int64{1, 7, 1000}[i%3],
+			CreatedAt: int64(1700000000 + i/2*10),
+			Content:   fmt.Sprintf("event %d %s", i, []string{"apple", "Banana", "cherry"}[i%3]),
+			Tags: [][]string{
+				{"t", []string{"red", "green"}[i%2]},
+				{"e", fmt.Sprintf("%064x", i/4), "wss://relay.example"},
+				{"x"},
+			},
+		}
+		if i%4 == 0 {
+			// with the t tag repeated, which must still match once
+			e.Tags = append(e.Tags, []string{"p", pubKey(k[3])}, e.Tags[0])
+		}
+		events = append(events, sign(t, k[i%3], e))
+	}
+
+	// published by k[1] on behalf of k[2]
+	delegated := &proto.Event{Kind: 1, CreatedAt: 1700000005, Content: "delegated", Tags: [][]string{}}
+	tag, err := proto.NewDelegation(k[2], pubKey(k[1]), &proto.Conditions{Kinds: []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegated.SetDelegation(tag)
+	events = append(events, sign(t, k[1], delegated))
+	return events
+}
+
+func testFilters(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	add(t, s, events...)
+	k := testKeys()
+
+	for _, f := range []struct {
+		name   string
+		filter *comm.Filter
+	}{
+		{"empty", &comm.Filter{}},
+		{"ids", &comm.Filter{IDs: []string{events[1].ID, events[5].ID, "00"}}},
+		{"authors", &comm.Filter{Authors: []string{pubKey(k[0]), pubKey(k[1])}}},
+		{"delegated author", &comm.Filter{Authors: []string{pubKey(k[2])}}},
+		{"kinds", &comm.Filter{Kinds: []int64{7, 1000}}},
+		{"since", &comm.Filter{Since: 1700000050}},
+		{"until", &comm.Filter{Until: 1700000050}},
+		{"since until", &comm.Filter{Since: 1700000020, Until: 1700000080}},
+		{"tag", &comm.Filter{TagFilters: map[string][]string{"t": {"red"}}}},
+		{"tag limit", &comm.Filter{TagFilters: map[string][]string{"t": {"red"}}, Limit: 4}},
+		{"tag values", &comm.Filter{TagFilters: map[string][]string{"e": {fmt.Sprintf("%064x", 0), fmt.Sprintf("%064x", 2)}}}},
+		{"tags", &comm.Filter{TagFilters: map[string][]string{"t": {"red"}, "p": {pubKey(k[3])}}}},
+		{"unknown tag", &comm.Filter{TagFilters: map[string][]string{"q": {"red"}}}},
+		{"search", &comm.Filter{Search: "banana"}},
+		{"partial search", &comm.Filter{Search: "ANAN vent"}},
+		{"short search", &comm.Filter{Search: "rr"}},
+		{"combined", &comm.Filter{Authors: []string{pubKey(k[1])}, Kinds: []int64{7}, Since: 1700000020, TagFilters: map[string][]string{"t": {"red"}}}},
+		{"nothing", &comm.Filter{Kinds: []int64{4}}},
+	} {
+		t.Run(f.name, func(t *testing.T) {
+			want := expected(events, f.filter)
+			if f.name != "nothing" && f.name != "unknown tag" && len(want) == 0 {
+				t.Fatal("test filter matches nothing")
+			}
+			check(t, s, want, f.filter)
+		})
+	}
+}
+
+func testMultipleFilters(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	add(t, s, events...)
+
+	// overlapping filters return each event once
+	checkMatch(t, s, events,
+		&comm.Filter{Kinds: []int64{1}},
+		&comm.Filter{TagFilters: map[string][]string{"t": {"red"}}},
+	)
+	checkMatch(t, s, events,
+		&comm.Filter{IDs: []string{events[0].ID}},
+		&comm.Filter{IDs: []string{events[0].ID, events[3].ID}},
+		&comm.Filter{Until: 1700000010},
+	)
+	got, err := s.Get(context.Background())
+	if err != nil || len(got) != 0 {
+		t.Fatal("no filters returned events", err)
+	}
+}
+
+func testLimitAndOrder(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	// stored out of order
+	for i := len(events) - 1; i >= 0; i-- {
+		add(t, s, events[i])
+	}
+	checkMatch(t, s, events, &comm.Filter{})
+	got, err := s.Get(context.Background(), &comm.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].CreatedAt > got[i-1].CreatedAt {
+			t.Fatalf("not newest first: %s", describe(got))
+		}
+	}
+	checkMatch(t, s, events, &comm.Filter{Limit: 3})
+	checkMatch(t, s, events, &comm.Filter{Kinds: []int64{1}, Limit: 2})
+	checkMatch(t, s, events, &comm.Filter{Limit: 100})
+	// ties go to the lowest id
+	checkMatch(t, s, events, &comm.Filter{Since: 1700000050, Limit: 1})
+
+	// each filter's limit applies to it alone
+	checkMatch(t, s, events,
+		&comm.Filter{Kinds: []int64{1}, Limit: 2},
+		&comm.Filter{Kinds: []int64{7}, Limit: 1},
+		&comm.Filter{Until: 1700000020},
+	)
+	checkMatch(t, s, events,
+		&comm.Filter{Kinds: []int64{1000}, Limit: 1},
+		&comm.Filter{Kinds: []int64{1000, 7}, Limit: 3},
+		&comm.Filter{IDs: []string{events[0].ID, events[4].ID, events[8].ID}, Limit: 2},
+	)
+}
+
+func testDuplicates(t *testing.T, s eventstore.EventStore) {
+	e := sign(t, testKeys()[0], &proto.Event{Kind: 1, CreatedAt: 1700000000, Content: "once"})
+	add(t, s, e)
+	if err := s.Add(context.Background(), e); err != eventstore.ErrDuplicate {
+		t.Fatalf("adding a duplicate returned %v, want ErrDuplicate", err)
+	}
+	check(t, s, []*proto.Event{e}, &comm.Filter{})
+}
+
+func testDelete(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	add(t, s, events...)
+	k := testKeys()
+
+	// as NIP-09 does, which mustn't delete others' events
+	del := &comm.Filter{IDs: []string{events[0].ID, events[1].ID}, Authors: []string{pubKey(k[0])}}
+	err := s.Delete(context.Background(), del)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []*proto.Event
+	for _, e := range events {
+		if !del.Match(e) {
+			left = append(left, e)
+		}
+	}
+	if len(left) != len(events)-1 {
+		t.Fatal("delete filter is wrong")
+	}
+	checkMatch(t, s, left, &comm.Filter{})
+
+	del = &comm.Filter{TagFilters: map[string][]string{"t": {"red"}}, Kinds: []int64{7}}
+	err = s.Delete(context.Background(), del)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rest []*proto.Event
+	for _, e := range left {
+		if !del.Match(e) {
+			rest = append(rest, e)
+		}
+	}
+	checkMatch(t, s, rest, &comm.Filter{})
+	checkMatch(t, s, rest, &comm.Filter{TagFilters: map[string][]string{"t": {"red"}}})
+
+	// deleted events can be stored again
+	add(t, s, events[0])
+	checkMatch(t, s, append(rest, events[0]), &comm.Filter{})
+}
+
+func testReplaceable(t *testing.T, s eventstore.EventStore) {
+	sf, ok := s.(eventstore.StoreFilterer)
+	if !ok {
+		t.Skip("store doesn't implement StoreFilterer")
+	}
+	sf.AddFilter(relay.StoreFilter)
+	sf.AddFilter(nip16.StoreFilter)
+	sf.AddFilter(nip33.StoreFilter)
+	k := testKeys()
+
+	ev := func(key *secp256k1.PrivateKey, kind, createdAt int64, tags ...[]string) *proto.Event {
+		return sign(t, key, &proto.Event{Kind: kind, CreatedAt: createdAt, Content: common.RandID(), Tags: tags})
+	}
+
+	meta1 := ev(k[0], 0, 100)
+	meta2 := ev(k[0], 0, 200)
+	meta3 := ev(k[0], 0, 150)
+	other := ev(k[1], 0, 50)
+	add(t, s, meta1, other, meta2)
+	// the newest wins, even when an older one arrives later
+	if err := s.Add(context.Background(), meta3); err != eventstore.ErrSuperseded {
+		t.Fatalf("adding an older replaceable event returned %v, want ErrSuperseded", err)
+	}
+	if err := s.Add(context.Background(), meta2); err != eventstore.ErrDuplicate {
+		t.Fatalf("adding the stored replaceable event again returned %v, want ErrDuplicate", err)
+	}
+	check(t, s, []*proto.Event{meta2, other}, &comm.Filter{Kinds: []int64{0}})
+
+	list1 := ev(k[0], 10002, 100)
+	list2 := ev(k[0], 10002, 300)
+	add(t, s, list1, list2)
+	check(t, s, []*proto.Event{list2}, &comm.Filter{Kinds: []int64{10002}})
+
+	// ties go to the lowest id
+	low := ev(k[0], 10003, 100)
+	high := ev(k[0], 10003, 100)
+	if high.ID < low.ID {
+		low, high = high, low
+	}
+	add(t, s, low)
+	if err := s.Add(context.Background(), high); err != eventstore.ErrSuperseded {
+		t.Fatalf("adding the higher id of a tie returned %v, want ErrSuperseded", err)
+	}
+	check(t, s, []*proto.Event{low}, &comm.Filter{Kinds: []int64{10003}})
+
+	a1 := ev(k[0], 30023, 100, []string{"d", "a"})
+	b1 := ev(k[0], 30023, 110, []string{"d", "b"})
+	a2 := ev(k[0], 30023, 120, []string{"d", "a"})
+	a3 := ev(k[1], 30023, 130, []string{"d", "a"})
+	add(t, s, a1, b1, a2, a3)
+	check(t, s, []*proto.Event{a3, a2, b1}, &comm.Filter{Kinds: []int64{30023}})
+
+	// replacing an event whose d tag is repeated
+	a4 := ev(k[0], 30023, 140, []string{"d", "a"}, []string{"d", "a"})
+	a5 := ev(k[0], 30023, 150, []string{"d", "a"})
+	add(t, s, a4)
+	check(t, s, []*proto.Event{a4, a3}, &comm.Filter{Kinds: []int64{30023}, TagFilters: map[string][]string{"d": {"a"}}, Limit: 2})
+	add(t, s, a5)
+	check(t, s, []*proto.Event{a5, a3}, &comm.Filter{Kinds: []int64{30023}, TagFilters: map[string][]string{"d": {"a"}}})
+
+	add(t, s, ev(k[0], 20001, 100))
+	check(t, s, nil, &comm.Filter{Kinds: []int64{20001}})
+}
+
+func testStream(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	add(t, s, events...)
+
+	filters := []*comm.Filter{
+		{Kinds: []int64{1}, Limit: 2},
+		{TagFilters: map[string][]string{"t": {"red"}}},
+	}
+	it, err := eventstore.Query(context.Background(), s, filters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*proto.Event
+	for it.Next() {
+		got = append(got, it.Event())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	it.Close()
+	want := expected(events, filters...)
+	if describe(got) != describe(want) {
+		t.Fatalf("got %s, want %s", describe(got), describe(want))
+	}
+
+	// iteration stops once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	it, err = eventstore.Query(ctx, s, &comm.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatal("no events", it.Err())
+	}
+	cancel()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() == nil || n >= len(events)-1 {
+		t.Fatalf("read %d more events after cancelling, error %v", n, it.Err())
+	}
+}
+
+func testContext(t *testing.T, s eventstore.EventStore) {
+	events := dataset(t)
+	add(t, s, events[1:]...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Add(ctx, events[0]); err == nil {
+		t.Fatal("add with cancelled context succeeded")
+	}
+	if _, err := s.Get(ctx, &comm.Filter{}); err == nil {
+		t.Fatal("get with cancelled context succeeded")
+	}
+	if err := s.Delete(ctx, &comm.Filter{}); err == nil {
+		t.Fatal("delete with cancelled context succeeded")
+	}
+	checkMatch(t, s, events[1:], &comm.Filter{})
+}
+
+func testConcurrent(t *testing.T, s eventstore.EventStore) {
+	k := testKeys()
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var events []*proto.Event
+	errs := make(chan error, writers*perWriter*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// not sign, which can't fail the test from here
+				e := &proto.Event{
+					Kind:      1,
+					CreatedAt: int64(1700000000 + w*perWriter + i),
+					Content:   common.RandID(),
+					Tags:      [][]string{},
+				}
+				if err := e.Sign(k[w%len(k)]); err != nil {
+					errs <- err
+					continue
+				}
+				if err := s.Add(context.Background(), e); err != nil {
+					errs <- err
+				}
+				mu.Lock()
+				events = append(events, e)
+				mu.Unlock()
+				if _, err := s.Get(context.Background(), &comm.Filter{Authors: []string{e.PubKey}, Limit: 5}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	checkMatch(t, s, events, &comm.Filter{})
+}
+
+func testLarge(t *testing.T, s eventstore.EventStore) {
+	n := 5000
+	if testing.Short() {
+		n = 500
+	}
+	k := testKeys()
+	events := make([]*proto.Event, n)
+	for i := range events {
+		events[i] = sign(t, k[i%len(k)], &proto.Event{
+			Kind:      int64(1 + i%5),
+			CreatedAt: int64(1700000000 + i/3),
+			Content:   fmt.Sprintf("event %d", i),
+			Tags:      [][]string{{"t", fmt.Sprintf("tag%d", i%50)}},
+		})
+	}
+	add(t, s, events...)
+
+	checkMatch(t, s, events, &comm.Filter{})
+	checkMatch(t, s, events, &comm.Filter{Authors: []string{pubKey(k[1])}, Kinds: []int64{2}, Limit: 20})
+	checkMatch(t, s, events, &comm.Filter{TagFilters: map[string][]string{"t": {"tag7", "tag8"}}})
+	checkMatch(t, s, events, &comm.Filter{Since: int64(1700000000 + n/2), Limit: 50})
+}
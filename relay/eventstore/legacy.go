@@ -0,0 +1,62 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+)
+
+// LegacyStore is the EventStore interface from before it took contexts.
+type LegacyStore interface {
+	Add(e *proto.Event) error
+	Get(filters ...*comm.Filter) ([]*proto.Event, error)
+	Delete(*comm.Filter) error
+}
+
+// FromLegacy adapts a store without context support. The context is only
+// checked before each call, which runs to completion once started. If s
+// has an AddFilter method the result is a StoreFilterer.
+func FromLegacy(s LegacyStore) EventStore {
+	ls := legacyStore{s}
+	if f, ok := s.(interface {
+		AddFilter(func(e *proto.Event) (FilterMethod, *comm.Filter))
+	}); ok {
+		return legacyFilterer{ls, f.AddFilter}
+	}
+	return ls
+}
+
+type legacyStore struct {
+	s LegacyStore
+}
+
+func (ls legacyStore) Add(ctx context.Context, e *proto.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ls.s.Add(e)
+}
+
+func (ls legacyStore) Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ls.s.Get(filters...)
+}
+
+func (ls legacyStore) Delete(ctx context.Context, f *comm.Filter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ls.s.Delete(f)
+}
+
+type legacyFilterer struct {
+	legacyStore
+	addFilter func(func(e *proto.Event) (FilterMethod, *comm.Filter))
+}
+
+func (lf legacyFilterer) AddFilter(f func(e *proto.Event) (FilterMethod, *comm.Filter)) {
+	lf.addFilter(f)
+}
@@ -0,0 +1,68 @@
+package eventstore_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/eventstoretest"
+)
+
+// sliceStore is a store written before EventStore took contexts.
+type sliceStore struct {
+	mu     sync.Mutex
+	events []*proto.Event
+}
+
+func (ss *sliceStore) Add(e *proto.Event) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, old := range ss.events {
+		if old.ID == e.ID {
+			return eventstore.ErrDuplicate
+		}
+	}
+	ss.events = append(ss.events, e)
+	return nil
+}
+
+func (ss *sliceStore) Get(filters ...*comm.Filter) ([]*proto.Event, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var results [][]*proto.Event
+	for _, f := range filters {
+		var matched []*proto.Event
+		for _, e := range ss.events {
+			if f.Match(e) {
+				matched = append(matched, e)
+			}
+		}
+		eventstore.Sort(matched)
+		if f.Limit > 0 && int64(len(matched)) > f.Limit {
+			matched = matched[:f.Limit]
+		}
+		results = append(results, matched)
+	}
+	return eventstore.Merge(results...), nil
+}
+
+func (ss *sliceStore) Delete(f *comm.Filter) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	kept := ss.events[:0]
+	for _, e := range ss.events {
+		if !f.Match(e) {
+			kept = append(kept, e)
+		}
+	}
+	ss.events = kept
+	return nil
+}
+
+func TestFromLegacy(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+		return eventstore.FromLegacy(&sliceStore{})
+	})
+}
@@ -0,0 +1,651 @@
+// Package logstore is an on-disk event store with no dependencies: events
+// are appended to segment files, indexed in memory, and removed by
+// appending tombstones. Segments full of deleted events are compacted in
+// the background.
+package logstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+)
+
+// segmentSize is the size at which the active segment is sealed and a new
+// one started.
+var segmentSize int64 = 64 << 20
+
+const (
+	// compactInterval is how often sealed segments are checked for
+	// compaction, which happens once compactRatio of them is dead.
+	compactInterval = time.Minute
+	compactRatio    = 0.5
+)
+
+var ErrClosed = errors.New("logstore: store is closed")
+
+func logf(format string, args ...interface{}) {
+	log.Printf("[logstore] "+format, args...)
+}
+
+// entry is the in-memory index entry for a stored event.
+type entry struct {
+	id        string
+	pubKey    string
+	delegator string
+	kind      int64
+	createdAt int64
+	tags      []string
+
+	seg  *segment
+	off  int64
+	size int
+
+	deleted bool
+}
+
+type req struct {
+	ctx     context.Context
+	e       *proto.Event
+	filter  *comm.Filter
+	compact bool
+	c       chan error
+}
+
+type LogStore struct {
+	dir string
+
+	// mu guards the index and segments; only the writer goroutine
+	// changes them.
+	mu       sync.RWMutex
+	segments []*segment
+	byID     map[string]*entry
+	all      []*entry
+	byPubKey map[string][]*entry
+	byKind   map[int64][]*entry
+	byTag    map[string][]*entry
+
+	filters []func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)
+
+	ch   chan req
+	done chan struct{}
+	stop chan struct{}
+}
+
+// New opens the store in dir, creating it if needed, and replays its
+// segments to rebuild the index.
+func New(dir string) (*LogStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	ls := &LogStore{
+		dir:  dir,
+		ch:   make(chan req, 10),
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	ls.resetIndex()
+
+	ranges, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range ranges {
+		s, err := ls.openSegment(r[0], r[1])
+		if err != nil {
+			ls.closeFiles()
+			return nil, err
+		}
+		err = s.replay(i == len(ranges)-1, func(typ byte, payload []byte, off int64, size int) error {
+			return ls.apply(s, typ, payload, off, size)
+		})
+		if err != nil {
+			ls.closeFiles()
+			return nil, err
+		}
+	}
+	if len(ls.segments) == 0 {
+		_, err := ls.openSegment(1, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go ls.run()
+	go ls.compactLoop()
+	return ls, nil
+}
+
+func (ls *LogStore) openSegment(first, last int) (*segment, error) {
+	f, err := os.OpenFile(filepath.Join(ls.dir, segmentName(first, last)), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &segment{first: first, last: last, f: f, size: st.Size()}
+	ls.segments = append(ls.segments, s)
+	return s, nil
+}
+
+func (ls *LogStore) active() *segment {
+	return ls.segments[len(ls.segments)-1]
+}
+
+func (ls *LogStore) resetIndex() {
+	ls.byID = map[string]*entry{}
+	ls.all = nil
+	ls.byPubKey = map[string][]*entry{}
+	ls.byKind = map[int64][]*entry{}
+	ls.byTag = map[string][]*entry{}
+}
+
+// apply updates the index for a record, during replay or after writing it.
+func (ls *LogStore) apply(s *segment, typ byte, payload []byte, off int64, size int) error {
+	switch typ {
+	case recordEvent:
+		e := &proto.Event{}
+		err := json.Unmarshal(payload, e)
+		if err != nil {
+			logf("skipping unreadable event in %s at %d: %v", segmentName(s.first, s.last), off, err)
+			return nil
+		}
+		ls.remove(e.ID)
+		ls.index(newEntry(e, s, off, size))
+		s.live += int64(size)
+	case recordTombstone:
+		ls.remove(string(payload))
+	}
+	return nil
+}
+
+func newEntry(e *proto.Event, s *segment, off int64, size int) *entry {
+	en := &entry{
+		id:        e.ID,
+		pubKey:    e.PubKey,
+		kind:      e.Kind,
+		createdAt: e.CreatedAt,
+		seg:       s,
+		off:       off,
+		size:      size,
+	}
+	if d, err := e.CheckDelegation(); err == nil {
+		en.delegator = d
+	}
+	for _, t := range e.Tags {
+		if len(t) >= 2 && len(t[0]) == 1 {
+			en.tags = append(en.tags, t[0]+t[1])
+		}
+	}
+	return en
+}
+
+func (ls *LogStore) index(en *entry) {
+	ls.byID[en.id] = en
+	ls.all = append(ls.all, en)
+	ls.byPubKey[en.pubKey] = append(ls.byPubKey[en.pubKey], en)
+	if en.delegator != "" && en.delegator != en.pubKey {
+		ls.byPubKey[en.delegator] = append(ls.byPubKey[en.delegator], en)
+	}
+	ls.byKind[en.kind] = append(ls.byKind[en.kind], en)
+	for _, t := range en.tags {
+		ls.byTag[t] = append(ls.byTag[t], en)
+	}
+}
+
+// remove marks the entry for id deleted. Dead entries stay in the index
+// lists until the next compaction rebuilds them.
+func (ls *LogStore) remove(id string) {
+	en, ok := ls.byID[id]
+	if !ok {
+		return
+	}
+	en.deleted = true
+	en.seg.live -= int64(en.size)
+	delete(ls.byID, id)
+}
+
+func (ls *LogStore) run() {
+	defer close(ls.done)
+	for {
+		select {
+		case r := <-ls.ch:
+			ls.handle(r)
+		case <-ls.stop:
+			// finish what was queued before Close
+			for {
+				select {
+				case r := <-ls.ch:
+					ls.handle(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (ls *LogStore) handle(r req) {
+	err := r.ctx.Err()
+	switch {
+	case err != nil:
+	case r.e != nil:
+		err = ls.add(r.ctx, r.e)
+	case r.filter != nil:
+		err = ls.delete(r.ctx, r.filter)
+	case r.compact:
+		err = ls.compact()
+	}
+	r.c <- err
+}
+
+func (ls *LogStore) compactLoop() {
+	t := time.NewTicker(compactInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if ls.needsCompaction() {
+				if err := ls.do(context.Background(), req{compact: true}); err != nil && err != ErrClosed {
+					logf("compaction failed: %v", err)
+				}
+			}
+		case <-ls.stop:
+			return
+		}
+	}
+}
+
+func (ls *LogStore) do(ctx context.Context, r req) error {
+	r.ctx = ctx
+	r.c = make(chan error, 1)
+	select {
+	case ls.ch <- r:
+	case <-ls.stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-r.c:
+		return err
+	case <-ls.done:
+		// queued as the writer stopped, which may have missed it
+		select {
+		case err := <-r.c:
+			return err
+		default:
+			return ErrClosed
+		}
+	}
+}
+
+func (ls *LogStore) Add(ctx context.Context, e *proto.Event) error {
+	return ls.do(ctx, req{e: e})
+}
+
+func (ls *LogStore) Delete(ctx context.Context, filter *comm.Filter) error {
+	return ls.do(ctx, req{filter: filter})
+}
+
+// Compact rewrites the sealed segments without their deleted events.
+func (ls *LogStore) Compact() error {
+	return ls.do(context.Background(), req{compact: true})
+}
+
+func (ls *LogStore) AddFilter(f func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)) {
+	ls.filters = append(ls.filters, f)
+}
+
+// writerView is the store as seen from the writer goroutine, which must
+// delete directly rather than queueing behind itself.
+type writerView struct {
+	*LogStore
+}
+
+func (w writerView) Delete(ctx context.Context, f *comm.Filter) error {
+	return w.delete(ctx, f)
+}
+
+func (ls *LogStore) add(ctx context.Context, e *proto.Event) error {
+	for _, filter := range ls.filters {
+		method, f := filter(e)
+		if method == eventstore.FilterMethodDrop {
+			return nil
+		}
+		if method == eventstore.FilterMethodSingle {
+			if err := eventstore.Replace(ctx, writerView{ls}, e, f); err != nil {
+				return err
+			}
+		}
+	}
+	ls.mu.RLock()
+	_, dup := ls.byID[e.ID]
+	ls.mu.RUnlock()
+	if dup {
+		return eventstore.ErrDuplicate
+	}
+	payload, err := e.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return ls.write(recordEvent, payload)
+}
+
+func (ls *LogStore) delete(ctx context.Context, filter *comm.Filter) error {
+	f := *filter
+	f.Limit = 0
+	events, err := ls.Get(ctx, &f)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		err := ls.write(recordTombstone, []byte(e.ID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends a record to the active segment, starting a new one if it
+// is full, and applies it to the index.
+func (ls *LogStore) write(typ byte, payload []byte) error {
+	if ls.active().size >= segmentSize {
+		err := ls.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	s := ls.active()
+	buf := appendRecord(nil, typ, payload)
+	_, err := s.f.WriteAt(buf, s.size)
+	if err != nil {
+		// drop whatever part was written
+		s.f.Truncate(s.size)
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	off := s.size
+	s.size += int64(len(buf))
+	return ls.apply(s, typ, payload, off, len(buf))
+}
+
+func (ls *LogStore) rotate() error {
+	s := ls.active()
+	err := s.f.Sync()
+	if err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	_, err = ls.openSegment(s.last+1, s.last+1)
+	return err
+}
+
+func (ls *LogStore) needsCompaction() bool {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	var size, live int64
+	for _, s := range ls.segments[:len(ls.segments)-1] {
+		size += s.size
+		live += s.live
+	}
+	return size > 0 && float64(size-live) >= compactRatio*float64(size)
+}
+
+// compact merges the sealed segments into one holding only their live
+// events. Tombstones in them can be dropped with the events they deleted,
+// which always come earlier in the log.
+func (ls *LogStore) compact() error {
+	sealed := ls.segments[:len(ls.segments)-1]
+	if len(sealed) == 0 {
+		return nil
+	}
+	first, last := sealed[0].first, sealed[len(sealed)-1].last
+	name := filepath.Join(ls.dir, segmentName(first, last))
+	tmp, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	out := &segment{first: first, last: last, f: tmp}
+
+	ls.mu.RLock()
+	var live []*entry
+	for _, en := range ls.all {
+		if !en.deleted && en.seg != ls.active() {
+			live = append(live, en)
+		}
+	}
+	ls.mu.RUnlock()
+
+	// the writer goroutine is the only one that moves entries, so the
+	// copy doesn't need to hold the lock
+	offs := make([]int64, len(live))
+	for i, en := range live {
+		buf := make([]byte, en.size)
+		_, err := en.seg.f.ReadAt(buf, en.off)
+		if err == nil {
+			_, err = tmp.WriteAt(buf, out.size)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(name + ".tmp")
+			return err
+		}
+		offs[i] = out.size
+		out.size += int64(en.size)
+	}
+	out.live = out.size
+	err = tmp.Sync()
+	if err == nil {
+		err = os.Rename(name+".tmp", name)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(name + ".tmp")
+		return err
+	}
+	syncDir(ls.dir)
+
+	ls.mu.Lock()
+	for i, en := range live {
+		en.seg = out
+		en.off = offs[i]
+	}
+	ls.segments = append([]*segment{out}, ls.active())
+	entries := make([]*entry, 0, len(ls.byID))
+	for _, en := range ls.all {
+		if !en.deleted {
+			entries = append(entries, en)
+		}
+	}
+	ls.resetIndex()
+	for _, en := range entries {
+		ls.index(en)
+	}
+	ls.mu.Unlock()
+
+	for _, s := range sealed {
+		s.f.Close()
+		if s.first != first || s.last != last {
+			os.Remove(filepath.Join(ls.dir, segmentName(s.first, s.last)))
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// candidates returns the entries that may match f, using the smallest
+// index that applies.
+func (ls *LogStore) candidates(f *comm.Filter) []*entry {
+	if len(f.IDs) > 0 {
+		var ret []*entry
+		for _, id := range f.IDs {
+			if en, ok := ls.byID[id]; ok {
+				ret = append(ret, en)
+			}
+		}
+		return ret
+	}
+	best := ls.all
+	try := func(lists [][]*entry) {
+		n := 0
+		for _, l := range lists {
+			n += len(l)
+		}
+		if n >= len(best) {
+			return
+		}
+		best = nil
+		for _, l := range lists {
+			best = append(best, l...)
+		}
+	}
+	if len(f.Authors) > 0 {
+		var lists [][]*entry
+		for _, a := range f.Authors {
+			lists = append(lists, ls.byPubKey[a])
+		}
+		try(lists)
+	}
+	if len(f.Kinds) > 0 {
+		var lists [][]*entry
+		for _, k := range f.Kinds {
+			lists = append(lists, ls.byKind[k])
+		}
+		try(lists)
+	}
+	for k, vals := range f.TagFilters {
+		if len(k) != 1 {
+			continue
+		}
+		var lists [][]*entry
+		for _, v := range vals {
+			lists = append(lists, ls.byTag[k+v])
+		}
+		try(lists)
+	}
+	return best
+}
+
+// mayMatch checks the parts of f the index has, before the event is read.
+func mayMatch(f *comm.Filter, en *entry) bool {
+	if f.Since > 0 && en.createdAt < f.Since {
+		return false
+	}
+	if f.Until > 0 && en.createdAt > f.Until {
+		return false
+	}
+	if len(f.Kinds) > 0 && !containsKind(f.Kinds, en.kind) {
+		return false
+	}
+	return true
+}
+
+func containsKind(kinds []int64, k int64) bool {
+	for _, v := range kinds {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (ls *LogStore) Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	read := map[*entry]*proto.Event{}
+	ret := []*proto.Event{}
+	for _, f := range filters {
+		seen := map[*entry]bool{}
+		var cands []*entry
+		for _, en := range ls.candidates(f) {
+			if !en.deleted && !seen[en] && mayMatch(f, en) {
+				seen[en] = true
+				cands = append(cands, en)
+			}
+		}
+		sort.Slice(cands, func(i, j int) bool {
+			if cands[i].createdAt != cands[j].createdAt {
+				return cands[i].createdAt > cands[j].createdAt
+			}
+			return cands[i].id < cands[j].id
+		})
+
+		var n int64
+		for _, en := range cands {
+			if f.Limit > 0 && n >= f.Limit {
+				break
+			}
+			e, ok := read[en]
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				payload, err := en.seg.readPayload(en.off, en.size)
+				if err != nil {
+					return nil, err
+				}
+				e = &proto.Event{}
+				err = json.Unmarshal(payload, e)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !f.Match(e) {
+				continue
+			}
+			n++
+			if !ok {
+				read[en] = e
+				ret = append(ret, e)
+			}
+		}
+	}
+	eventstore.Sort(ret)
+	return ret, nil
+}
+
+// Close waits for pending writes and closes the segment files.
+func (ls *LogStore) Close() error {
+	close(ls.stop)
+	<-ls.done
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	err := ls.active().f.Sync()
+	ls.closeFiles()
+	return err
+}
+
+func (ls *LogStore) closeFiles() {
+	for _, s := range ls.segments {
+		s.f.Close()
+	}
+}
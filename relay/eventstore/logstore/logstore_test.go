@@ -0,0 +1,279 @@
+package logstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/eventstoretest"
+)
+
+func newEvents(t *testing.T, n int) []*proto.Event {
+	key := common.GeneratePrivateKey()
+	events := make([]*proto.Event, n)
+	for i := range events {
+		events[i] = &proto.Event{
+			Kind:      int64(1 + i%2),
+			CreatedAt: int64(1000 + i),
+			Content:   common.RandID(),
+			Tags:      [][]string{{"t", string(rune('a' + i%3))}},
+		}
+		events[i].Sign(key)
+	}
+	return events
+}
+
+func ids(events []*proto.Event) []string {
+	var ret []string
+	for _, e := range events {
+		ret = append(ret, e.ID)
+	}
+	return ret
+}
+
+// expect checks Get returns want, which is given oldest first.
+func expect(t *testing.T, ls *LogStore, f *comm.Filter, want ...*proto.Event) {
+	t.Helper()
+	got, err := ls.Get(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w := want[len(want)-1-i]
+		if got[i].ID != w.ID || got[i].Content != w.Content {
+			t.Fatalf("event %d is %s, want %s", i, got[i].ID, w.ID)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	ls, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := newEvents(t, 6)
+	for _, e := range ev {
+		if err := ls.Add(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ls.Add(context.Background(), ev[0])
+
+	expect(t, ls, &comm.Filter{}, ev...)
+	expect(t, ls, &comm.Filter{Kinds: []int64{2}}, ev[1], ev[3], ev[5])
+	expect(t, ls, &comm.Filter{Authors: []string{ev[0].PubKey}, Limit: 2}, ev[4], ev[5])
+	expect(t, ls, &comm.Filter{TagFilters: map[string][]string{"t": {"a"}}}, ev[0], ev[3])
+	expect(t, ls, &comm.Filter{IDs: ids(ev[2:4]), Since: 1003}, ev[3])
+
+	err = ls.Delete(context.Background(), &comm.Filter{TagFilters: map[string][]string{"t": {"b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ls, &comm.Filter{}, ev[0], ev[2], ev[3], ev[5])
+
+	// deletes and the index survive a restart
+	ls.Close()
+	if err := ls.Add(context.Background(), ev[1]); err != ErrClosed {
+		t.Fatal(err)
+	}
+	ls, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	expect(t, ls, &comm.Filter{}, ev[0], ev[2], ev[3], ev[5])
+
+	// deleted events can be stored again
+	ls.Add(context.Background(), ev[1])
+	expect(t, ls, &comm.Filter{Kinds: []int64{2}}, ev[1], ev[3], ev[5])
+}
+
+func TestFilters(t *testing.T) {
+	ls, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	ls.AddFilter(func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
+		if e.Kind == 2 {
+			return eventstore.FilterMethodDrop, nil
+		}
+		return eventstore.FilterMethodSingle, &comm.Filter{Authors: []string{e.PubKey}}
+	})
+	ev := newEvents(t, 3)
+	for _, e := range ev {
+		ls.Add(context.Background(), e)
+	}
+	expect(t, ls, &comm.Filter{}, ev[2])
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	ls, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := newEvents(t, 3)
+	for _, e := range ev {
+		ls.Add(context.Background(), e)
+	}
+	ls.Close()
+
+	name := filepath.Join(dir, segmentName(1, 1))
+	st, _ := os.Stat(name)
+	// cut the last record short
+	os.Truncate(name, st.Size()-5)
+
+	ls, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ls, &comm.Filter{}, ev[0], ev[1])
+	ls.Add(context.Background(), ev[2])
+	ls.Close()
+
+	// and corrupt a byte in the middle one
+	f, _ := os.OpenFile(name, os.O_RDWR, 0)
+	size := int64(len(appendRecord(nil, recordEvent, must(ev[0].MarshalJSON()))))
+	f.WriteAt([]byte{'X'}, size+headerSize+20)
+	f.Close()
+
+	ls, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	expect(t, ls, &comm.Filter{}, ev[0])
+	if st, _ := os.Stat(name); st.Size() != size {
+		t.Fatal("segment not truncated", st.Size(), size)
+	}
+}
+
+func TestDamagedSealedSegment(t *testing.T) {
+	defer func(old int64) { segmentSize = old }(segmentSize)
+	segmentSize = 1000
+
+	dir := t.TempDir()
+	ls, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range newEvents(t, 10) {
+		ls.Add(context.Background(), e)
+	}
+	ls.Close()
+
+	name := filepath.Join(dir, segmentName(1, 1))
+	st, _ := os.Stat(name)
+	f, _ := os.OpenFile(name, os.O_RDWR, 0)
+	f.WriteAt([]byte{'X'}, headerSize+20)
+	f.Close()
+
+	// a sealed segment wasn't being written, so isn't cut short
+	_, err = New(dir)
+	if !errors.Is(err, errCorrupt) {
+		t.Fatal("opened a damaged store:", err)
+	}
+	if st2, _ := os.Stat(name); st2.Size() != st.Size() {
+		t.Fatal("sealed segment truncated", st2.Size(), st.Size())
+	}
+}
+
+func must(buf []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func TestCompact(t *testing.T) {
+	defer func(old int64) { segmentSize = old }(segmentSize)
+	segmentSize = 1000
+
+	dir := t.TempDir()
+	ls, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := newEvents(t, 30)
+	for _, e := range ev {
+		ls.Add(context.Background(), e)
+	}
+	ls.Delete(context.Background(), &comm.Filter{Kinds: []int64{1}})
+	if !ls.needsCompaction() {
+		t.Fatal("half deleted store doesn't need compaction")
+	}
+	if err := ls.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if ls.needsCompaction() {
+		t.Fatal("compacted store needs compaction")
+	}
+	var odd []*proto.Event
+	for i := 1; i < len(ev); i += 2 {
+		odd = append(odd, ev[i])
+	}
+	expect(t, ls, &comm.Filter{}, odd...)
+	expect(t, ls, &comm.Filter{TagFilters: map[string][]string{"t": {"b"}}}, ev[1], ev[7], ev[13], ev[19], ev[25])
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatal(len(entries), "segments after compaction")
+	}
+	ls.Close()
+
+	// an interrupted compaction leaves the segments it covered behind
+	os.WriteFile(filepath.Join(dir, segmentName(1, 1)), []byte("stale"), 0o644)
+	os.WriteFile(filepath.Join(dir, "junk.seg.tmp"), nil, 0o644)
+	ls, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	expect(t, ls, &comm.Filter{}, odd...)
+	entries, _ = os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatal(len(entries), "segments after reopening")
+	}
+}
+
+func TestCloseWhileWriting(t *testing.T) {
+	ls, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newEvents(t, 50)
+	errs := make(chan error, len(events))
+	for _, e := range events {
+		go func(e *proto.Event) {
+			errs <- ls.Add(context.Background(), e)
+		}(e)
+	}
+	ls.Close()
+	for range events {
+		if err := <-errs; err != nil && err != ErrClosed {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+		ls, err := New(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ls.Close() })
+		return ls
+	})
+}
@@ -0,0 +1,183 @@
+package logstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A record is a little endian uint32 payload length, the CRC-32C of the
+// type and payload, a type byte and the payload.
+const headerSize = 9
+
+const (
+	recordEvent     byte = 1
+	recordTombstone byte = 2
+)
+
+// maxRecordSize bounds the length read from a header, so that a corrupt
+// one is caught rather than allocated.
+const maxRecordSize = 64 << 20
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorrupt = errors.New("logstore: corrupt record")
+)
+
+// segment is a file of records. Segments written by compaction cover the
+// range of segments they replace, so the name of each is first-last.seg.
+type segment struct {
+	first, last int
+	f           *os.File
+	size        int64
+	// live is the number of bytes of records that are still current.
+	live int64
+}
+
+func segmentName(first, last int) string {
+	return fmt.Sprintf("%08d-%08d.seg", first, last)
+}
+
+func parseSegmentName(name string) (int, int, bool) {
+	if !strings.HasSuffix(name, ".seg") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSuffix(name, ".seg"), "-")
+	if !ok {
+		return 0, 0, false
+	}
+	f, err1 := strconv.Atoi(first)
+	l, err2 := strconv.Atoi(last)
+	if err1 != nil || err2 != nil || l < f {
+		return 0, 0, false
+	}
+	return f, l, true
+}
+
+// listSegments returns the segment ranges in dir in replay order,
+// removing temporary files and segments left behind by a compaction that
+// was interrupted after its output was committed.
+func listSegments(dir string) ([][2]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ranges [][2]int
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if f, l, ok := parseSegmentName(e.Name()); ok {
+			ranges = append(ranges, [2]int{f, l})
+		}
+	}
+	// widest first, so covered segments come after what covers them
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i][0] != ranges[j][0] {
+			return ranges[i][0] < ranges[j][0]
+		}
+		return ranges[i][1] > ranges[j][1]
+	})
+	var ret [][2]int
+	for _, r := range ranges {
+		if len(ret) > 0 && r[1] <= ret[len(ret)-1][1] {
+			err := os.Remove(filepath.Join(dir, segmentName(r[0], r[1])))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func appendRecord(buf []byte, typ byte, payload []byte) []byte {
+	var hdr [headerSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(len(payload)))
+	crc := crc32.Update(crc32.Update(0, crcTable, []byte{typ}), crcTable, payload)
+	binary.LittleEndian.PutUint32(hdr[4:8], crc)
+	hdr[8] = typ
+	buf = append(buf, hdr[:]...)
+	return append(buf, payload...)
+}
+
+// replay calls f for each record in the segment. Only the active segment
+// can have been torn by a crash, so if it has a torn or corrupt record the
+// file is truncated after the last good one; in a sealed segment that is
+// damage, and replay fails rather than throw away what follows.
+func (s *segment) replay(active bool, f func(typ byte, payload []byte, off int64, size int) error) error {
+	_, err := s.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.f)
+	var off int64
+	var hdr [headerSize]byte
+	for {
+		_, err := io.ReadFull(r, hdr[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return s.bad(active, off, err)
+		}
+		n := binary.LittleEndian.Uint32(hdr[0:4])
+		if n > maxRecordSize {
+			return s.bad(active, off, errCorrupt)
+		}
+		payload := make([]byte, n)
+		_, err = io.ReadFull(r, payload)
+		if err != nil {
+			return s.bad(active, off, err)
+		}
+		crc := crc32.Update(crc32.Update(0, crcTable, hdr[8:9]), crcTable, payload)
+		if crc != binary.LittleEndian.Uint32(hdr[4:8]) {
+			return s.bad(active, off, errCorrupt)
+		}
+		size := headerSize + int(n)
+		err = f(hdr[8], payload, off, size)
+		if err != nil {
+			return err
+		}
+		off += int64(size)
+	}
+	s.size = off
+	return nil
+}
+
+func (s *segment) bad(active bool, off int64, cause error) error {
+	if !active {
+		return fmt.Errorf("logstore: %s damaged at %d: %w", segmentName(s.first, s.last), off, cause)
+	}
+	return s.truncate(off, cause)
+}
+
+func (s *segment) truncate(off int64, cause error) error {
+	logf("truncating %s at %d: %v", segmentName(s.first, s.last), off, cause)
+	err := s.f.Truncate(off)
+	if err != nil {
+		return err
+	}
+	s.size = off
+	return nil
+}
+
+func (s *segment) readPayload(off int64, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	_, err := s.f.ReadAt(buf, off)
+	if err != nil {
+		return nil, err
+	}
+	return buf[headerSize:], nil
+}
@@ -1,6 +1,12 @@
+// Package memory is an in-memory event store, indexed by id, author, kind
+// and single-letter tag. It can be capped by event count or approximate
+// size, evicting the oldest events, to serve as a cache.
 package memory
 
 import (
+	"container/heap"
+	"context"
+	"sort"
 	"sync"
 
 	"github.com/andyleap/nostr/proto"
@@ -8,87 +14,412 @@ import (
 	"github.com/andyleap/nostr/relay/eventstore"
 )
 
+type addReq struct {
+	ctx context.Context
+	e   *proto.Event
+	c   chan error
+}
+
+type entry struct {
+	e         *proto.Event
+	size      int64
+	delegator string
+	tags      []string
+	deleted   bool
+}
+
+// before orders entries oldest first, the reverse of eventstore.Sort, so
+// that ties in created_at come out lowest id first when read newest first.
+func before(a, b *entry) bool {
+	if a.e.CreatedAt != b.e.CreatedAt {
+		return a.e.CreatedAt < b.e.CreatedAt
+	}
+	return a.e.ID > b.e.ID
+}
+
+// list is an index list in before order. Removed entries are only marked
+// deleted, and dropped once they make up half the list.
+type list struct {
+	entries []*entry
+	dead    int
+	// start is where the live entries begin, all before it being dead
+	start int
+}
+
+func (l *list) insert(en *entry) {
+	n := len(l.entries)
+	if n == 0 || !before(en, l.entries[n-1]) {
+		l.entries = append(l.entries, en)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return before(en, l.entries[i]) })
+	l.entries = append(l.entries, nil)
+	copy(l.entries[i+1:], l.entries[i:])
+	l.entries[i] = en
+	if i < l.start {
+		l.start = i
+	}
+}
+
+func (l *list) removed() {
+	l.dead++
+	if l.dead > 32 && l.dead*2 > len(l.entries) {
+		live := make([]*entry, 0, len(l.entries)-l.dead)
+		for _, en := range l.entries[l.start:] {
+			if !en.deleted {
+				live = append(live, en)
+			}
+		}
+		l.entries = live
+		l.dead = 0
+		l.start = 0
+	}
+}
+
+func (l *list) oldest() *entry {
+	for ; l.start < len(l.entries); l.start++ {
+		if en := l.entries[l.start]; !en.deleted {
+			return en
+		}
+	}
+	return nil
+}
+
+// span returns the part of the list within since and until.
+func (l *list) span(since, until int64) []*entry {
+	entries := l.entries
+	if until > 0 {
+		entries = entries[:sort.Search(len(entries), func(i int) bool { return entries[i].e.CreatedAt > until })]
+	}
+	if since > 0 {
+		entries = entries[sort.Search(len(entries), func(i int) bool { return entries[i].e.CreatedAt >= since }):]
+	}
+	return entries
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func unlist[K comparable](m map[K]*list, k K) {
+	l := m[k]
+	l.removed()
+	if l.dead == len(l.entries) {
+		delete(m, k)
+	}
+}
+
 type MemoryStore struct {
-	events  []*proto.Event
-	mu      sync.Mutex
+	// MaxEvents and MaxBytes cap the store, the oldest events being
+	// evicted to stay within them. Zero means no cap. Set them before the
+	// store is used.
+	MaxEvents int
+	MaxBytes  int64
+
+	mu       sync.RWMutex
+	byID     map[string]*entry
+	all      *list
+	byPubKey map[string]*list
+	byKind   map[int64]*list
+	byTag    map[string]*list
+	bytes    int64
+
 	filters []func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)
-	ch      chan *proto.Event
+	ch      chan addReq
 }
 
 func New() *MemoryStore {
 	ms := &MemoryStore{
-		ch: make(chan *proto.Event, 10),
+		byID:     map[string]*entry{},
+		all:      &list{},
+		byPubKey: map[string]*list{},
+		byKind:   map[int64]*list{},
+		byTag:    map[string]*list{},
+		ch:       make(chan addReq, 10),
 	}
 	go func() {
-		for e := range ms.ch {
-			ms.add(e)
+		for ar := range ms.ch {
+			ms.add(ar)
 		}
 	}()
 	return ms
 }
 
-func (ms *MemoryStore) Add(e *proto.Event) error {
-	ms.ch <- e
-	return nil
+func (ms *MemoryStore) Add(ctx context.Context, e *proto.Event) error {
+	eCh := make(chan error)
+	select {
+	case ms.ch <- addReq{
+		ctx: ctx,
+		e:   e,
+		c:   eCh,
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-eCh
 }
 
-func (ms *MemoryStore) add(e *proto.Event) {
+func (ms *MemoryStore) add(ar addReq) {
+	defer close(ar.c)
+	if err := ar.ctx.Err(); err != nil {
+		ar.c <- err
+		return
+	}
+	e := ar.e
 	for _, filter := range ms.filters {
 		method, f := filter(e)
 		if method == eventstore.FilterMethodDrop {
 			return
 		}
 		if method == eventstore.FilterMethodSingle {
-			ms.Delete(f)
+			if err := eventstore.Replace(ar.ctx, ms, e, f); err != nil {
+				ar.c <- err
+				return
+			}
 		}
 	}
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	ms.events = append(ms.events, e)
-	return
+	if _, ok := ms.byID[e.ID]; ok {
+		ar.c <- eventstore.ErrDuplicate
+		return
+	}
+	ms.index(newEntry(e))
+	ms.evict()
 }
 
-func (ms *MemoryStore) Get(filters ...*comm.Filter) ([]*proto.Event, error) {
-	if len(filters) == 0 {
-		return nil, nil
+func newEntry(e *proto.Event) *entry {
+	en := &entry{e: e, size: eventSize(e)}
+	if d, err := e.CheckDelegation(); err == nil && d != e.PubKey {
+		en.delegator = d
 	}
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
-	events := []*proto.Event{}
-	for _, e := range ms.events {
-		match := false
-		for _, filter := range filters {
-			if filter.Match(e) {
-				match = true
-				break
+	seen := map[string]bool{}
+	for _, t := range e.Tags {
+		if len(t) >= 2 && len(t[0]) == 1 && !seen[t[0]+t[1]] {
+			seen[t[0]+t[1]] = true
+			en.tags = append(en.tags, t[0]+t[1])
+		}
+	}
+	return en
+}
+
+// eventSize estimates the memory an event and its index entries use.
+func eventSize(e *proto.Event) int64 {
+	n := 256 + len(e.ID) + len(e.PubKey) + len(e.Sig) + len(e.Content)
+	for _, t := range e.Tags {
+		n += 24 + 8
+		for _, v := range t {
+			n += 16 + len(v)
+		}
+	}
+	return int64(n)
+}
+
+func listFor[K comparable](m map[K]*list, k K) *list {
+	l, ok := m[k]
+	if !ok {
+		l = &list{}
+		m[k] = l
+	}
+	return l
+}
+
+func (ms *MemoryStore) index(en *entry) {
+	ms.byID[en.e.ID] = en
+	ms.bytes += en.size
+	ms.all.insert(en)
+	listFor(ms.byPubKey, en.e.PubKey).insert(en)
+	if en.delegator != "" {
+		listFor(ms.byPubKey, en.delegator).insert(en)
+	}
+	listFor(ms.byKind, en.e.Kind).insert(en)
+	for _, t := range en.tags {
+		listFor(ms.byTag, t).insert(en)
+	}
+}
+
+func (ms *MemoryStore) remove(en *entry) {
+	en.deleted = true
+	delete(ms.byID, en.e.ID)
+	ms.bytes -= en.size
+	ms.all.removed()
+	unlist(ms.byPubKey, en.e.PubKey)
+	if en.delegator != "" {
+		unlist(ms.byPubKey, en.delegator)
+	}
+	unlist(ms.byKind, en.e.Kind)
+	for _, t := range en.tags {
+		unlist(ms.byTag, t)
+	}
+}
+
+func (ms *MemoryStore) evict() {
+	for len(ms.byID) > 0 &&
+		(ms.MaxEvents > 0 && len(ms.byID) > ms.MaxEvents || ms.MaxBytes > 0 && ms.bytes > ms.MaxBytes) {
+		ms.remove(ms.all.oldest())
+	}
+}
+
+// candidates returns the index lists that hold every event f may match,
+// choosing the smallest index that applies.
+func (ms *MemoryStore) candidates(f *comm.Filter) []*list {
+	best := []*list{ms.all}
+	bestLen := len(ms.all.entries)
+	try := func(lists []*list) {
+		n := 0
+		for _, l := range lists {
+			n += len(l.entries)
+		}
+		if n < bestLen {
+			best, bestLen = lists, n
+		}
+	}
+	if len(f.Authors) > 0 {
+		var lists []*list
+		for _, a := range f.Authors {
+			if l, ok := ms.byPubKey[a]; ok {
+				lists = append(lists, l)
+			}
+		}
+		try(lists)
+	}
+	if len(f.Kinds) > 0 {
+		var lists []*list
+		for _, k := range f.Kinds {
+			if l, ok := ms.byKind[k]; ok {
+				lists = append(lists, l)
+			}
+		}
+		try(lists)
+	}
+	for k, vals := range f.TagFilters {
+		if len(k) != 1 {
+			continue
+		}
+		var lists []*list
+		for _, v := range vals {
+			if l, ok := ms.byTag[k+v]; ok {
+				lists = append(lists, l)
 			}
 		}
-		if match {
-			events = append(events, e)
+		try(lists)
+	}
+	return best
+}
+
+// scan calls fn with the events matching f, newest first, stopping after
+// limit of them if limit is positive.
+func (ms *MemoryStore) scan(f *comm.Filter, limit int64, fn func(en *entry)) {
+	var spans [][]*entry
+	if len(f.IDs) > 0 {
+		var found []*entry
+		for i, id := range f.IDs {
+			if en, ok := ms.byID[id]; ok && !containsID(f.IDs[:i], id) {
+				found = append(found, en)
+			}
+		}
+		sort.Slice(found, func(i, j int) bool { return before(found[i], found[j]) })
+		spans = [][]*entry{found}
+	} else {
+		for _, l := range ms.candidates(f) {
+			spans = append(spans, l.span(f.Since, f.Until))
 		}
 	}
-	maxLimit := filters[0].Limit
-	for _, filter := range filters {
-		if filter.Limit > maxLimit {
-			maxLimit = filter.Limit
+	h := spanHeap{}
+	for _, s := range spans {
+		if len(s) > 0 {
+			h = append(h, s)
 		}
 	}
-	if len(events) > int(maxLimit) {
-		events = events[len(events)-int(maxLimit):]
+	heap.Init(&h)
+	var n int64
+	var last *entry
+	for h.Len() > 0 {
+		s := h[0]
+		en := s[len(s)-1]
+		if len(s) == 1 {
+			heap.Pop(&h)
+		} else {
+			h[0] = s[:len(s)-1]
+			heap.Fix(&h, 0)
+		}
+		// an event can be in more than one of the lists, and the merge
+		// hands out its copies one after another
+		if en == last {
+			continue
+		}
+		last = en
+		if en.deleted {
+			continue
+		}
+		if !f.Match(en.e) {
+			continue
+		}
+		fn(en)
+		n++
+		if limit > 0 && n >= limit {
+			return
+		}
 	}
+}
+
+// spanHeap orders spans by their newest entry, newest first, for merging
+// them.
+type spanHeap [][]*entry
+
+func (h spanHeap) Len() int           { return len(h) }
+func (h spanHeap) Less(i, j int) bool { return before(h[j][len(h[j])-1], h[i][len(h[i])-1]) }
+func (h spanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *spanHeap) Push(x any) {
+	*h = append(*h, x.([]*entry))
+}
+
+func (h *spanHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+func (ms *MemoryStore) Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	seen := map[*entry]bool{}
+	events := []*proto.Event{}
+	for _, f := range filters {
+		ms.scan(f, f.Limit, func(en *entry) {
+			if !seen[en] {
+				seen[en] = true
+				events = append(events, en.e)
+			}
+		})
+	}
+	eventstore.Sort(events)
 	return events, nil
 }
 
-func (ms *MemoryStore) Delete(filter *comm.Filter) error {
+func (ms *MemoryStore) Delete(ctx context.Context, filter *comm.Filter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	newEvents := ms.events[:0]
-	for _, e := range ms.events {
-		if !filter.Match(e) {
-			newEvents = append(newEvents, e)
-		}
+	var found []*entry
+	ms.scan(filter, 0, func(en *entry) {
+		found = append(found, en)
+	})
+	for _, en := range found {
+		ms.remove(en)
 	}
-	ms.events = newEvents
 	return nil
 }
 
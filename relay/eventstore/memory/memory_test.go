@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/eventstoretest"
+)
+
+func TestConformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+		return New()
+	})
+}
+
+// fakeEvent makes an unsigned event, which the store doesn't check, so
+// large stores can be filled quickly.
+func fakeEvent(i int) *proto.Event {
+	return &proto.Event{
+		ID:        fmt.Sprintf("%064x", i),
+		PubKey:    fmt.Sprintf("%064x", i%1000),
+		CreatedAt: int64(1000000 + i),
+		Kind:      int64(i % 10),
+		Tags:      [][]string{{"t", fmt.Sprint(i % 100)}},
+		Content:   "hello",
+	}
+}
+
+func TestEviction(t *testing.T) {
+	ms := New()
+	ms.MaxEvents = 100
+	// added out of order, so the oldest aren't the first added
+	for i := 0; i < 300; i++ {
+		ms.Add(context.Background(), fakeEvent((i*7+3)%300))
+	}
+	events, _ := ms.Get(context.Background(), &comm.Filter{})
+	if len(events) != 100 {
+		t.Fatalf("got %d events, want 100", len(events))
+	}
+	if events[99].CreatedAt != 1000200 || events[0].CreatedAt != 1000299 {
+		t.Fatalf("kept %d to %d, want the newest", events[99].CreatedAt, events[0].CreatedAt)
+	}
+	events, _ = ms.Get(context.Background(), &comm.Filter{Kinds: []int64{3}})
+	if len(events) != 10 {
+		t.Fatalf("got %d kind 3 events, want 10", len(events))
+	}
+
+	ms = New()
+	ms.MaxBytes = 10 * eventSize(fakeEvent(40))
+	for i := 0; i < 50; i++ {
+		ms.Add(context.Background(), fakeEvent(i))
+	}
+	events, _ = ms.Get(context.Background(), &comm.Filter{})
+	if len(events) != 10 || events[9].CreatedAt != 1000040 {
+		t.Fatalf("got %d events from %d, want 10 from 1000040", len(events), events[len(events)-1].CreatedAt)
+	}
+}
+
+func TestDeleteReindex(t *testing.T) {
+	ms := New()
+	for i := 0; i < 10000; i++ {
+		ms.Add(context.Background(), fakeEvent(i))
+	}
+	// the tag's events are all kind 3, and most of them go, so its list
+	// is compacted
+	ms.Delete(context.Background(), &comm.Filter{Kinds: []int64{1, 2, 3, 4, 5, 6, 7, 8}, Until: 1007999})
+	if l := ms.byTag["t13"]; len(l.entries)-l.dead != 20 || len(l.entries) >= 100 {
+		t.Fatalf("tag list holds %d entries, %d dead, want 20 live after compaction", len(l.entries), l.dead)
+	}
+	for i := 10000; i < 11000; i++ {
+		ms.Add(context.Background(), fakeEvent(i))
+	}
+	events, _ := ms.Get(context.Background(), &comm.Filter{TagFilters: map[string][]string{"t": {"13"}}})
+	if len(events) != 30 {
+		t.Fatalf("got %d events, want 30", len(events))
+	}
+	for _, e := range events {
+		if e.Tags[0][1] != "13" || e.CreatedAt < 1008000 {
+			t.Fatalf("unexpected event %v", e)
+		}
+	}
+}
+
+var (
+	benchStore *MemoryStore
+	benchOnce  sync.Once
+)
+
+const benchEvents = 1000000
+
+func loadedStore(b *testing.B) *MemoryStore {
+	benchOnce.Do(func() {
+		benchStore = New()
+		for i := 0; i < benchEvents; i++ {
+			benchStore.Add(context.Background(), fakeEvent(i))
+		}
+	})
+	return benchStore
+}
+
+func benchmarkGet(b *testing.B, f *comm.Filter) {
+	ms := loadedStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		events, _ := ms.Get(context.Background(), f)
+		if len(events) == 0 {
+			b.Fatal("no events")
+		}
+	}
+}
+
+func BenchmarkGetRecent(b *testing.B) {
+	benchmarkGet(b, &comm.Filter{Limit: 100})
+}
+
+func BenchmarkGetByID(b *testing.B) {
+	benchmarkGet(b, &comm.Filter{IDs: []string{fakeEvent(12345).ID, fakeEvent(999999).ID}})
+}
+
+func BenchmarkGetByAuthor(b *testing.B) {
+	benchmarkGet(b, &comm.Filter{Authors: []string{fakeEvent(7).PubKey}, Limit: 100})
+}
+
+func BenchmarkGetByManyAuthors(b *testing.B) {
+	// a follow list
+	var authors []string
+	for i := 0; i < 500; i++ {
+		authors = append(authors, fakeEvent(i).PubKey)
+	}
+	benchmarkGet(b, &comm.Filter{Authors: authors, Limit: 500})
+}
+
+func BenchmarkGetByKindAndTag(b *testing.B) {
+	benchmarkGet(b, &comm.Filter{
+		Kinds:      []int64{1, 3},
+		TagFilters: map[string][]string{"t": {"11", "13"}},
+		Limit:      100,
+	})
+}
+
+func BenchmarkGetTimeRange(b *testing.B) {
+	benchmarkGet(b, &comm.Filter{Since: 1500000, Until: 1500500, Kinds: []int64{2}})
+}
+
+func BenchmarkAdd(b *testing.B) {
+	ms := New()
+	ms.MaxEvents = benchEvents
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ms.Add(context.Background(), fakeEvent(i))
+	}
+}
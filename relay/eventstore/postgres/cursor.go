@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+)
+
+// fetchSize is how many rows a cursor fetches at a time.
+const fetchSize = 100
+
+// cursor streams query results through a server-side cursor, so only one
+// batch of rows is held at a time.
+type cursor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tx     *sql.Tx
+	rows   *sql.Rows
+	// n is how many rows the current batch has given
+	n    int
+	done bool
+
+	e   *proto.Event
+	err error
+}
+
+// Query implements eventstore.Streamer. The cursor holds a connection
+// until it is closed or Config.QueryTimeout passes, after which Next
+// stops with context.DeadlineExceeded.
+func (ps *PostgresStore) Query(ctx context.Context, filters ...*comm.Filter) (eventstore.Iterator, error) {
+	if len(filters) == 0 {
+		return &cursor{done: true}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.QueryTimeout)
+	tx, err := ps.conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	query, args := buildQuery(filters...)
+	_, err = tx.ExecContext(ctx, "DECLARE events_cursor NO SCROLL CURSOR FOR "+query, args...)
+	if err != nil {
+		log.Println("Error querying for events:", query, args, err)
+		tx.Rollback()
+		cancel()
+		return nil, err
+	}
+	return &cursor{ctx: ctx, cancel: cancel, tx: tx}, nil
+}
+
+func (c *cursor) Next() bool {
+	if !c.done && c.err == nil {
+		c.err = c.ctx.Err()
+	}
+	for !c.done && c.err == nil {
+		if c.rows == nil {
+			c.rows, c.err = c.tx.QueryContext(c.ctx, fmt.Sprintf("FETCH %d FROM events_cursor", fetchSize))
+			c.n = 0
+			continue
+		}
+		if !c.rows.Next() {
+			c.err = c.rows.Err()
+			c.rows.Close()
+			c.rows = nil
+			c.done = c.n < fetchSize
+			continue
+		}
+		c.n++
+		e, err := scanEvent(c.rows)
+		if err != nil {
+			c.err = err
+			continue
+		}
+		// duplicates from overlapping filters are next to each other
+		if c.e != nil && c.e.ID == e.ID {
+			continue
+		}
+		c.e = e
+		return true
+	}
+	return false
+}
+
+func (c *cursor) Event() *proto.Event {
+	return c.e
+}
+
+func (c *cursor) Err() error {
+	return c.err
+}
+
+func (c *cursor) Close() error {
+	c.done = true
+	if c.rows != nil {
+		c.rows.Close()
+		c.rows = nil
+	}
+	if c.tx == nil {
+		return nil
+	}
+	err := c.tx.Rollback()
+	c.tx = nil
+	c.cancel()
+	if err == sql.ErrTxDone {
+		// cancelled with the context, or timed out
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS tags (
+    event_id CHAR(64) NOT NULL,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL
+);
+
+INSERT INTO tags (event_id, name, value)
+SELECT e.id, t->>0, t->>1
+FROM events e, jsonb_array_elements(e.tags) t
+WHERE jsonb_typeof(t) = 'array'
+    AND t->>0 IS NOT NULL
+    AND t->>1 IS NOT NULL
+    AND octet_length(t->>1) <= 1024;
+
+CREATE INDEX IF NOT EXISTS tags_name_value ON tags (name, value, event_id);
+CREATE INDEX IF NOT EXISTS tags_event_id ON tags (event_id);
+CREATE INDEX IF NOT EXISTS events_created_at ON events (created_at);
+
+ALTER TABLE events DROP COLUMN IF EXISTS mungedTags;
+
+COMMIT;
@@ -0,0 +1,48 @@
+BEGIN;
+
+CREATE TABLE events_new (
+    id BYTEA NOT NULL PRIMARY KEY,
+    pubkey BYTEA NOT NULL,
+    created_at BIGINT NOT NULL,
+    kind INT NOT NULL,
+    tags JSONB NOT NULL,
+    content TEXT NOT NULL,
+    sig BYTEA NOT NULL
+);
+
+-- rows that aren't valid hex were never valid events, and an id can only
+-- belong to one of them
+INSERT INTO events_new (id, pubkey, created_at, kind, tags, content, sig)
+SELECT decode(id, 'hex'), decode(pubkey, 'hex'), created_at, kind, tags, content, decode(sig, 'hex')
+FROM events
+WHERE id ~ '^[0-9a-f]{64}$' AND pubkey ~ '^[0-9a-f]{64}$' AND sig ~ '^[0-9a-f]{128}$'
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE tags_new (
+    event_id BYTEA NOT NULL REFERENCES events_new (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL
+);
+
+INSERT INTO tags_new (event_id, name, value)
+SELECT e.id, t->>0, t->>1
+FROM events_new e, jsonb_array_elements(e.tags) t
+WHERE jsonb_typeof(t) = 'array'
+    AND t->>0 IS NOT NULL
+    AND t->>1 IS NOT NULL
+    AND octet_length(t->>1) <= 1024;
+
+DROP TABLE tags;
+DROP TABLE events;
+ALTER TABLE events_new RENAME TO events;
+ALTER TABLE tags_new RENAME TO tags;
+ALTER INDEX events_new_pkey RENAME TO events_pkey;
+
+CREATE INDEX events_created_at ON events (created_at DESC);
+CREATE INDEX events_kind_created_at ON events (kind, created_at DESC);
+CREATE INDEX events_pubkey_created_at ON events (pubkey, created_at DESC);
+CREATE INDEX events_pubkey_kind_created_at ON events (pubkey, kind, created_at DESC);
+CREATE INDEX tags_name_value ON tags (name, value, event_id);
+CREATE INDEX tags_event_id ON tags (event_id);
+
+COMMIT;
@@ -3,9 +3,13 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
@@ -13,98 +17,91 @@ import (
 	"github.com/lib/pq"
 )
 
-type addReq struct {
-	e *proto.Event
-	c chan error
+// Config tunes a PostgresStore. Zero fields get the defaults.
+type Config struct {
+	// MaxOpenConns and MaxIdleConns size the connection pool, as with
+	// sql.DB. MaxOpenConns defaults to no limit and MaxIdleConns to 2.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// Events are inserted in batches of up to BatchSize, written at most
+	// FlushInterval after the first of them arrives.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// QueryTimeout bounds how long a streaming query may hold its
+	// connection, which it does while the caller works through the
+	// results, so that slow readers can't use up the pool.
+	QueryTimeout time.Duration
 }
 
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Millisecond
+	defaultQueryTimeout  = 30 * time.Second
+)
+
 type PostgresStore struct {
 	conn    *sql.DB
+	cfg     Config
 	filters []func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)
 	ch      chan addReq
 }
 
 func New(connStr string) (*PostgresStore, error) {
+	return NewWithConfig(connStr, Config{})
+}
+
+func NewWithConfig(connStr string, cfg Config) (*PostgresStore, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.QueryTimeout <= 0 {
+		cfg.QueryTimeout = defaultQueryTimeout
+	}
 	conn, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	err = migrateDB(context.Background(), conn)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan addReq, 10)
 	ps := &PostgresStore{
 		conn: conn,
-		ch:   ch,
+		cfg:  cfg,
+		ch:   make(chan addReq, cfg.BatchSize),
 	}
-	go func() {
-		for ar := range ch {
-			ps.add(ar)
-		}
-	}()
+	go ps.run()
 
 	return ps, nil
 }
 
-func (ps *PostgresStore) Add(e *proto.Event) error {
-	eCh := make(chan error)
-	ps.ch <- addReq{
-		e: e,
-		c: eCh,
+func (ps *PostgresStore) Add(ctx context.Context, e *proto.Event) error {
+	eCh := make(chan error, 1)
+	select {
+	case ps.ch <- addReq{
+		ctx: ctx,
+		e:   e,
+		c:   eCh,
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 	return <-eCh
 }
 
-/*
-
-CREATE TABLE IF NOT EXISTS events (
-    id CHAR(32) NOT NULL,
-    pubkey CHAR(32) NOT NULL,
-    created_at TIMESTAMP NOT NULL,
-    kind INT NOT NULL,
-    tags JSONB NOT NULL,
-    content TEXT NOT NULL,
-    sig CHAR(64) NOT NULL,
-    PRIMARY KEY (id, pubkey),
-    INDEX (kind),
-    INDEX (id),
-    INDEX (pubkey),
-);
-
-*/
-
-func (ps *PostgresStore) add(ar addReq) {
-	defer close(ar.c)
-	e := ar.e
-	for _, filter := range ps.filters {
-		method, f := filter(e)
-		if method == eventstore.FilterMethodDrop {
-			return
-		}
-		if method == eventstore.FilterMethodSingle {
-			ps.Delete(f)
-		}
-	}
-	tagBuf, _ := json.Marshal(e.Tags)
-	mungedTags := map[string][]string{}
-	for _, v := range e.Tags {
-		if len(v) < 2 {
-			continue
-		}
-		if len(v[1]) != 1 {
-			continue
-		}
-		mungedTags[v[0]] = append(mungedTags[v[0]], v[1])
-	}
-	mungedTagsBuf, _ := json.Marshal(mungedTags)
-	_, err := ps.conn.Exec("INSERT INTO events (id, pubkey, created_at, kind, tags, mungedTags, content, sig) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)", e.ID, e.PubKey, e.CreatedAt, e.Kind, tagBuf, mungedTagsBuf, e.Content, e.Sig)
-	ar.c <- err
-	return
-}
-
 /*
 	IDs     []string
 	Authors []string
@@ -117,8 +114,13 @@ func (ps *PostgresStore) add(ar addReq) {
 */
 
 func buildWhereClause(filters ...*comm.Filter) (string, []interface{}) {
+	return appendWhereClause([]interface{}{}, filters...)
+}
+
+// appendWhereClause builds a where clause with its arguments numbered
+// after args.
+func appendWhereClause(args []interface{}, filters ...*comm.Filter) (string, []interface{}) {
 	query := "WHERE ("
-	args := []interface{}{}
 	for i, filter := range filters {
 		if i != 0 {
 			query += ") OR ("
@@ -126,12 +128,16 @@ func buildWhereClause(filters ...*comm.Filter) (string, []interface{}) {
 		sep := ""
 		if len(filter.IDs) > 0 {
 			query += fmt.Sprintf("id = ANY($%d)", len(args)+1)
-			args = append(args, pq.StringArray(filter.IDs))
+			args = append(args, hexArray(filter.IDs))
 			sep = " AND "
 		}
 		if len(filter.Authors) > 0 {
-			query += sep + fmt.Sprintf("pubkey = ANY($%d)", len(args)+1)
-			args = append(args, pq.StringArray(filter.Authors))
+			// the relay only stores delegated events with valid
+			// delegations, so the tag can be trusted here. ARRAY makes
+			// the delegated ids a constant, so both sides of the OR can
+			// use an index.
+			query += sep + fmt.Sprintf("(pubkey = ANY($%d) OR id = ANY(ARRAY(SELECT event_id FROM tags WHERE name = 'delegation' AND value = ANY($%d))))", len(args)+1, len(args)+2)
+			args = append(args, hexArray(filter.Authors), pq.StringArray(filter.Authors))
 			sep = " AND "
 		}
 		if len(filter.Kinds) > 0 {
@@ -149,70 +155,113 @@ func buildWhereClause(filters ...*comm.Filter) (string, []interface{}) {
 			args = append(args, filter.Until)
 			sep = " AND "
 		}
-		if len(filter.TagFilters) > 0 {
-			query += sep + "("
-			subsep := ""
-			for k, vals := range filter.TagFilters {
-				query += subsep + fmt.Sprintf("tags->'%s' ?| $%d", k, len(args)+1)
-				args = append(args, pq.StringArray(vals))
-				subsep = " AND "
-			}
-			query += ")"
+		for _, term := range comm.SearchTerms(filter.Search) {
+			query += sep + fmt.Sprintf("content ILIKE $%d", len(args)+1)
+			args = append(args, "%"+escapeLike(term)+"%")
+			sep = " AND "
+		}
+		names := make([]string, 0, len(filter.TagFilters))
+		for k := range filter.TagFilters {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			query += sep + fmt.Sprintf("id IN (SELECT event_id FROM tags WHERE name = $%d AND value = ANY($%d))", len(args)+1, len(args)+2)
+			args = append(args, k, pq.StringArray(filter.TagFilters[k]))
+			sep = " AND "
+		}
+		if sep == "" {
+			query += "TRUE"
 		}
 	}
 	query += ")"
 	return query, args
 }
 
-func (ps *PostgresStore) Get(filters ...*comm.Filter) ([]*proto.Event, error) {
-	if len(filters) == 0 {
-		return nil, nil
+// hexArray decodes ids and pubkeys for comparing with the bytea columns.
+// Values that aren't hex can't match anything, so are left out.
+func hexArray(vals []string) pq.ByteaArray {
+	ret := pq.ByteaArray{}
+	for _, v := range vals {
+		if b, err := hex.DecodeString(v); err == nil {
+			ret = append(ret, b)
+		}
 	}
-	query := "SELECT id, pubkey, created_at, kind, tags, content, sig FROM events "
+	return ret
+}
 
-	where, args := buildWhereClause(filters...)
-	query += where + " ORDER BY created_at DESC"
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
-	limit := int(filters[0].Limit)
-	for _, filter := range filters {
-		if int(filter.Limit) > limit {
-			limit = int(filter.Limit)
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+const selectEvents = "SELECT id, pubkey, created_at, kind, tags, content, sig FROM events "
+
+// buildQuery builds a query for the events matching filters, newest first,
+// with each filter's limit applied to it alone. An event matching more
+// than one filter comes back once for each, next to itself.
+func buildQuery(filters ...*comm.Filter) (string, []interface{}) {
+	args := []interface{}{}
+	parts := make([]string, len(filters))
+	for i, filter := range filters {
+		var where string
+		where, args = appendWhereClause(args, filter)
+		parts[i] = selectEvents + where + " ORDER BY created_at DESC, id"
+		if filter.Limit > 0 {
+			parts[i] += fmt.Sprintf(" LIMIT %d", filter.Limit)
 		}
 	}
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
+	if len(parts) == 1 {
+		return parts[0], args
 	}
+	return "SELECT * FROM ((" + strings.Join(parts, ") UNION ALL (") + ")) AS q ORDER BY created_at DESC, id", args
+}
 
-	rows, err := ps.conn.Query(query, args...)
+func scanEvent(rows *sql.Rows) (*proto.Event, error) {
+	e := &proto.Event{}
+	tagraw := []byte{}
+	var id, pubKey, sig []byte
+	err := rows.Scan(&id, &pubKey, &e.CreatedAt, &e.Kind, &tagraw, &e.Content, &sig)
+	if err != nil {
+		return nil, err
+	}
+	e.ID = hex.EncodeToString(id)
+	e.PubKey = hex.EncodeToString(pubKey)
+	e.Sig = hex.EncodeToString(sig)
+	err = json.Unmarshal(tagraw, &e.Tags)
+	return e, err
+}
+
+func (ps *PostgresStore) Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error) {
+	ret := []*proto.Event{}
+	if len(filters) == 0 {
+		return ret, nil
+	}
+	query, args := buildQuery(filters...)
+	rows, err := ps.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Println("Error querying for events:", query, args, err)
 		return nil, err
 	}
 	defer rows.Close()
-	ret := []*proto.Event{}
 	for rows.Next() {
-		e := &proto.Event{}
-		tagraw := []byte{}
-
-		rows.Scan(&e.ID, &e.PubKey, &e.CreatedAt, &e.Kind, &tagraw, &e.Content, &e.Sig)
-		json.Unmarshal(tagraw, &e.Tags)
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		if len(ret) > 0 && ret[len(ret)-1].ID == e.ID {
+			continue
+		}
 		ret = append(ret, e)
 	}
-	//reverse ret so that it's in chronological order
-	for i := len(ret)/2 - 1; i >= 0; i-- {
-		opp := len(ret) - 1 - i
-		ret[i], ret[opp] = ret[opp], ret[i]
-	}
-	return ret, nil
+	return ret, rows.Err()
 }
 
-func (ps *PostgresStore) Delete(filter *comm.Filter) error {
-	query := "DELETE FROM events "
-
+func (ps *PostgresStore) Delete(ctx context.Context, filter *comm.Filter) error {
+	// tags go with their events
 	where, args := buildWhereClause(filter)
-	query += where
-
-	_, err := ps.conn.Exec(query, args...)
+	_, err := ps.conn.ExecContext(ctx, "DELETE FROM events "+where, args...)
 	return err
 }
 
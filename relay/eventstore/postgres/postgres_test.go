@@ -0,0 +1,287 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/eventstoretest"
+)
+
+// testDSN connects to a database the tests may empty and recreate tables
+// in, given in POSTGRES_TEST_DSN.
+func testDSN(t *testing.T) string {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	return dsn
+}
+
+func TestConformance(t *testing.T) {
+	dsn := testDSN(t)
+	eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+		ps, err := New(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ps.conn.Exec("TRUNCATE events, tags")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ps.conn.Close() })
+		return ps
+	})
+}
+
+func TestTagQueryParameterized(t *testing.T) {
+	key := `e' OR 1=1 --`
+	where, args := buildWhereClause(&comm.Filter{TagFilters: map[string][]string{key: {"x"}, "p": {"y"}}})
+	if strings.Contains(where, key) {
+		t.Fatal("tag name in query:", where)
+	}
+	if len(args) != 4 || args[0] != key || args[2] != "p" {
+		t.Fatal("unexpected arguments", args)
+	}
+}
+
+func TestQueryPlans(t *testing.T) {
+	ps, err := New(testDSN(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.conn.Close()
+	ctx := context.Background()
+	_, err = ps.conn.Exec("TRUNCATE events, tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	for k := 0; k < 4; k++ {
+		key := common.GeneratePrivateKey()
+		keys = append(keys, common.PubKeyHex(key.PubKey()))
+		for i := 0; i < 50; i++ {
+			e := &proto.Event{
+				Kind:      int64(1 + i%3),
+				CreatedAt: int64(1000 + i),
+				Content:   common.RandID(),
+				Tags:      [][]string{{"e", fmt.Sprintf("%064x", i%10)}},
+			}
+			e.Sign(key)
+			if err := ps.Add(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tagFilter := &comm.Filter{TagFilters: map[string][]string{"e": {fmt.Sprintf("%064x", 3)}}}
+	got, err := ps.Get(ctx, tagFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 20 {
+		t.Fatalf("got %d events, want 20", len(got))
+	}
+
+	conn, err := ps.conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "ANALYZE; SET enable_seqscan = off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		filter *comm.Filter
+		index  string
+	}{
+		{tagFilter, "tags_name_value"},
+		{&comm.Filter{Authors: keys[:2], Kinds: []int64{1}, Limit: 10}, "events_pubkey_"},
+		{&comm.Filter{Kinds: []int64{2}, Limit: 10}, "events_kind_created_at"},
+	} {
+		query, args := buildQuery(test.filter)
+		rows, err := conn.QueryContext(ctx, "EXPLAIN "+query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plan string
+		for rows.Next() {
+			var line string
+			rows.Scan(&line)
+			plan += line + "\n"
+		}
+		rows.Close()
+		if !strings.Contains(plan, test.index) {
+			t.Fatalf("query doesn't use %s:\n%s", test.index, plan)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dsn := testDSN(t)
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	initSQL, err := migrations.ReadFile("migrations/1.init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec("DROP TABLE IF EXISTS tags, events, migrations")
+	if err == nil {
+		_, err = conn.Exec(string(initSQL))
+	}
+	if err == nil {
+		_, err = conn.Exec("CREATE TABLE migrations (version int); INSERT INTO migrations (version) VALUES (1)")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an event stored by the first schema, and one that was never valid
+	e := &proto.Event{
+		Kind:      1,
+		CreatedAt: 1700000000,
+		Content:   "from before",
+		Tags:      [][]string{{"e", fmt.Sprintf("%064x", 1)}, {"t", "old"}},
+	}
+	e.Sign(common.GeneratePrivateKey())
+	tags, _ := json.Marshal(e.Tags)
+	insert := "INSERT INTO events (id, pubkey, created_at, kind, tags, mungedTags, content, sig) VALUES ($1, $2, $3, $4, $5, '{}', $6, $7)"
+	_, err = conn.Exec(insert, e.ID, e.PubKey, e.CreatedAt, e.Kind, tags, e.Content, e.Sig)
+	if err == nil {
+		_, err = conn.Exec(insert, "nothex", e.PubKey, e.CreatedAt, e.Kind, "[]", "bad", e.Sig)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.conn.Close()
+	got, err := ps.Get(context.Background(), &comm.Filter{TagFilters: map[string][]string{"t": {"old"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != e.ID || got[0].Validate() != nil {
+		t.Fatalf("got %v after migrating, want %v", got, e)
+	}
+	var n int
+	ps.conn.QueryRow("SELECT count(*) FROM events").Scan(&n)
+	if n != 1 {
+		t.Fatalf("%d events after migrating, want 1", n)
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	dsn := testDSN(t)
+	ps, err := NewWithConfig(dsn, Config{BatchSize: 8, FlushInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.conn.Close()
+	_, err = ps.conn.Exec("TRUNCATE events, tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := common.GeneratePrivateKey()
+	var events []*proto.Event
+	for i := 0; i < 4; i++ {
+		e := &proto.Event{Kind: 1, CreatedAt: 1700000000 + int64(i), Content: fmt.Sprint(i), Tags: [][]string{{"t", "batch"}}}
+		e.Sign(key)
+		events = append(events, e)
+	}
+	if err := ps.Add(context.Background(), events[0]); err != nil {
+		t.Fatal(err)
+	}
+	bad := *events[1]
+	bad.ID = "nothex"
+	// stored before, twice in the batch, new, and not valid
+	batch := []*proto.Event{events[0], events[2], events[2], events[3], &bad}
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i, e := range batch {
+		wg.Add(1)
+		go func(i int, e *proto.Event) {
+			defer wg.Done()
+			errs[i] = ps.Add(context.Background(), e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	if errs[0] != eventstore.ErrDuplicate {
+		t.Error("stored event:", errs[0])
+	}
+	if (errs[1] == nil) == (errs[2] == nil) || errs[1] != eventstore.ErrDuplicate && errs[2] != eventstore.ErrDuplicate {
+		t.Error("event added twice:", errs[1], errs[2])
+	}
+	if errs[3] != nil {
+		t.Error("new event:", errs[3])
+	}
+	if errs[4] == nil {
+		t.Error("invalid event stored")
+	}
+	got, err := ps.Get(context.Background(), &comm.Filter{TagFilters: map[string][]string{"t": {"batch"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3", len(got))
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	dsn := testDSN(t)
+	ps, err := NewWithConfig(dsn, Config{QueryTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.conn.Close()
+	_, err = ps.conn.Exec("TRUNCATE events, tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := common.GeneratePrivateKey()
+	for i := 0; i < fetchSize+1; i++ {
+		e := &proto.Event{Kind: 1, CreatedAt: 1700000000 + int64(i), Content: fmt.Sprint(i)}
+		e.Sign(key)
+		if err := ps.Add(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it, err := ps.Query(context.Background(), &comm.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	// a reader too slow to finish in time
+	time.Sleep(200 * time.Millisecond)
+	for it.Next() {
+	}
+	if it.Err() != context.DeadlineExceeded {
+		t.Fatal("query outlived its timeout:", it.Err())
+	}
+	it.Close()
+	if n := ps.conn.Stats().InUse; n != 0 {
+		t.Fatalf("%d connections still in use", n)
+	}
+}
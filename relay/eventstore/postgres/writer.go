@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/lib/pq"
+)
+
+type addReq struct {
+	ctx context.Context
+	e   *proto.Event
+	c   chan error
+}
+
+// run collects added events into batches and writes them.
+func (ps *PostgresStore) run() {
+	for ar := range ps.ch {
+		batch := []addReq{ar}
+		flush := time.NewTimer(ps.cfg.FlushInterval)
+	collect:
+		for len(batch) < ps.cfg.BatchSize {
+			select {
+			case ar := <-ps.ch:
+				batch = append(batch, ar)
+			case <-flush.C:
+				break collect
+			}
+		}
+		flush.Stop()
+		ps.write(batch)
+	}
+}
+
+// write applies the store filters to a batch and inserts what is left,
+// replying to each request.
+func (ps *PostgresStore) write(batch []addReq) {
+	var pending []addReq
+	for _, ar := range batch {
+		if err := ar.ctx.Err(); err != nil {
+			ar.c <- err
+			continue
+		}
+		ok, err := ps.filter(ar, &pending)
+		if !ok {
+			ar.c <- err
+			continue
+		}
+		pending = append(pending, ar)
+	}
+	ps.insert(pending)
+}
+
+// filter reports whether ar's event should be inserted, replacing older
+// events if a filter says to. Those may still be pending, so pending is
+// inserted first.
+func (ps *PostgresStore) filter(ar addReq, pending *[]addReq) (bool, error) {
+	for _, filter := range ps.filters {
+		method, f := filter(ar.e)
+		if method == eventstore.FilterMethodDrop {
+			return false, nil
+		}
+		if method == eventstore.FilterMethodSingle {
+			ps.insert(*pending)
+			*pending = nil
+			if err := eventstore.Replace(ar.ctx, ps, ar.e, f); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func (ps *PostgresStore) insert(batch []addReq) {
+	if len(batch) == 0 {
+		return
+	}
+	events := make([]*proto.Event, len(batch))
+	for i, ar := range batch {
+		events[i] = ar.e
+	}
+	for i, err := range ps.insertEvents(events) {
+		batch[i].c <- err
+	}
+}
+
+// maxTagValue is the longest tag value indexed, keeping index entries
+// well inside the limit on their size. Longer values can't be queried.
+const maxTagValue = 1024
+
+// rows holds events as columns for inserting with unnest.
+type rows struct {
+	ids, pubKeys, sigs  pq.ByteaArray
+	createdAts, kinds   pq.Int64Array
+	tags, contents      pq.StringArray
+	tagIDs              pq.ByteaArray
+	tagNames, tagValues pq.StringArray
+}
+
+func (r *rows) add(e *proto.Event) error {
+	id, err := hex.DecodeString(e.ID)
+	if err != nil {
+		return err
+	}
+	pubKey, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return err
+	}
+	tags := e.Tags
+	if tags == nil {
+		tags = [][]string{}
+	}
+	tagBuf, _ := json.Marshal(tags)
+
+	r.ids = append(r.ids, id)
+	r.pubKeys = append(r.pubKeys, pubKey)
+	r.sigs = append(r.sigs, sig)
+	r.createdAts = append(r.createdAts, e.CreatedAt)
+	r.kinds = append(r.kinds, e.Kind)
+	r.tags = append(r.tags, string(tagBuf))
+	r.contents = append(r.contents, e.Content)
+	for _, t := range tags {
+		if len(t) < 2 || len(t[1]) > maxTagValue {
+			continue
+		}
+		r.tagIDs = append(r.tagIDs, id)
+		r.tagNames = append(r.tagNames, t[0])
+		r.tagValues = append(r.tagValues, t[1])
+	}
+	return nil
+}
+
+// insertEvents stores events in one transaction and returns the result
+// for each: nil, eventstore.ErrDuplicate if it was already stored, or
+// the error that stopped it. If the transaction fails the events are
+// retried one at a time, so that one bad event doesn't fail the rest.
+func (ps *PostgresStore) insertEvents(events []*proto.Event) []error {
+	errs := make([]error, len(events))
+	r := &rows{}
+	var added []int
+	seen := map[string]bool{}
+	for i, e := range events {
+		if seen[e.ID] {
+			errs[i] = eventstore.ErrDuplicate
+			continue
+		}
+		seen[e.ID] = true
+		if err := r.add(e); err != nil {
+			errs[i] = err
+			continue
+		}
+		added = append(added, i)
+	}
+	if len(added) == 0 {
+		return errs
+	}
+	inserted, err := ps.insertRows(context.Background(), r)
+	if err != nil {
+		if len(added) == 1 {
+			errs[added[0]] = err
+			return errs
+		}
+		for _, i := range added {
+			errs[i] = ps.insertEvents(events[i : i+1])[0]
+		}
+		return errs
+	}
+	for _, i := range added {
+		if !inserted[events[i].ID] {
+			errs[i] = eventstore.ErrDuplicate
+		}
+	}
+	return errs
+}
+
+// insertRows inserts r, skipping events already stored, and returns the
+// ids of those it inserted.
+func (ps *PostgresStore) insertRows(ctx context.Context, r *rows) (map[string]bool, error) {
+	tx, err := ps.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.QueryContext(ctx, `INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig)
+		SELECT id, pubkey, created_at, kind, tags::jsonb, content, sig
+		FROM unnest($1::bytea[], $2::bytea[], $3::bigint[], $4::int[], $5::text[], $6::text[], $7::bytea[])
+			AS e (id, pubkey, created_at, kind, tags, content, sig)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id`,
+		r.ids, r.pubKeys, r.createdAts, r.kinds, r.tags, r.contents, r.sigs)
+	if err != nil {
+		return nil, err
+	}
+	inserted := map[string]bool{}
+	for res.Next() {
+		var id []byte
+		if err := res.Scan(&id); err != nil {
+			res.Close()
+			return nil, err
+		}
+		inserted[hex.EncodeToString(id)] = true
+	}
+	res.Close()
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	// only the inserted events' tags, the others already have theirs
+	var tagIDs pq.ByteaArray
+	var names, values pq.StringArray
+	for i, id := range r.tagIDs {
+		if inserted[hex.EncodeToString(id)] {
+			tagIDs = append(tagIDs, id)
+			names = append(names, r.tagNames[i])
+			values = append(values, r.tagValues[i])
+		}
+	}
+	if len(tagIDs) > 0 {
+		_, err = tx.ExecContext(ctx, "INSERT INTO tags (event_id, name, value) SELECT * FROM unnest($1::bytea[], $2::text[], $3::text[])", tagIDs, names, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inserted, tx.Commit()
+}
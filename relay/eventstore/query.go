@@ -0,0 +1,69 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+)
+
+// Iterator steps through the results of a query, like sql.Rows: call Next
+// until it returns false, then check Err. Close releases what the query
+// holds and must always be called.
+type Iterator interface {
+	Next() bool
+	Event() *proto.Event
+	Err() error
+	Close() error
+}
+
+// Streamer is implemented by stores that can return events as they are
+// read instead of collecting them first.
+type Streamer interface {
+	Query(ctx context.Context, filters ...*comm.Filter) (Iterator, error)
+}
+
+// Query returns the events matching filters in the order Get does,
+// streaming them if s is a Streamer and using Get otherwise. Iteration
+// stops with ctx's error when it is cancelled.
+func Query(ctx context.Context, s EventStore, filters ...*comm.Filter) (Iterator, error) {
+	if st, ok := s.(Streamer); ok {
+		return st.Query(ctx, filters...)
+	}
+	events, err := s.Get(ctx, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return &sliceIterator{ctx: ctx, events: events}, nil
+}
+
+type sliceIterator struct {
+	ctx    context.Context
+	events []*proto.Event
+	e      *proto.Event
+	err    error
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.err != nil || len(it.events) == 0 {
+		return false
+	}
+	if it.err = it.ctx.Err(); it.err != nil {
+		return false
+	}
+	it.e, it.events = it.events[0], it.events[1:]
+	return true
+}
+
+func (it *sliceIterator) Event() *proto.Event {
+	return it.e
+}
+
+func (it *sliceIterator) Err() error {
+	return it.err
+}
+
+func (it *sliceIterator) Close() error {
+	it.events = nil
+	return nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+func migrateDB(ctx context.Context, db *sql.DB) error {
+	var version int
+	r := db.QueryRow("SELECT version FROM migrations")
+	err := r.Scan(&version)
+	if err != nil {
+		_, err = db.ExecContext(ctx, "CREATE TABLE migrations (version int); INSERT INTO migrations (version) VALUES (0);")
+		if err != nil {
+			return err
+		}
+		version = 0
+	}
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		vi, _ := strconv.Atoi(strings.Split(entries[i].Name(), ".")[0])
+		vj, _ := strconv.Atoi(strings.Split(entries[j].Name(), ".")[0])
+		return vi < vj
+	})
+	log.Println("[DB] Current version:", version)
+	for _, entry := range entries {
+		v, err := strconv.Atoi(strings.Split(entry.Name(), ".")[0])
+		if err != nil || v <= version {
+			continue
+		}
+		log.Println("[DB] Migrating to version:", v)
+		migration, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, string(migration))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE migrations SET version = ?", v)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		version = v
+	}
+	return nil
+}
+
+// setupSearch creates the FTS5 index, reporting whether this build of
+// SQLite has it. The index is of trigrams, so that terms match inside
+// words as they do with LIKE; an older index of whole words is replaced.
+// Events stored while the index didn't exist, or by a build without FTS5,
+// are missing from it, so it is rebuilt from events if the two don't hold
+// the same number of events.
+func setupSearch(ctx context.Context, db *sql.DB) bool {
+	var schema string
+	err := db.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE name = 'events_fts'").Scan(&schema)
+	if err == nil && !strings.Contains(schema, "trigram") {
+		_, err = db.ExecContext(ctx, "DROP TABLE events_fts")
+		if err != nil {
+			log.Println("[DB] Full text search unavailable, falling back to LIKE:", err)
+			return false
+		}
+	}
+	_, err = db.ExecContext(ctx, "CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5(id UNINDEXED, content, tokenize = 'trigram')")
+	if err != nil {
+		log.Println("[DB] Full text search unavailable, falling back to LIKE:", err)
+		return false
+	}
+	var events, indexed int
+	err = db.QueryRowContext(ctx, "SELECT (SELECT count(*) FROM events), (SELECT count(*) FROM events_fts)").Scan(&events, &indexed)
+	if err == nil && events != indexed {
+		log.Printf("[DB] Rebuilding full text index of %d events", events)
+		err = rebuildSearch(ctx, db)
+	}
+	if err != nil {
+		log.Println("[DB] Full text index unusable, falling back to LIKE:", err)
+		return false
+	}
+	return true
+}
+
+func rebuildSearch(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM events_fts")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO events_fts (id, content) SELECT id, content FROM events")
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
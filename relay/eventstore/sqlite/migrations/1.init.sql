@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS events (
+    id TEXT NOT NULL PRIMARY KEY,
+    pubkey TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    kind INTEGER NOT NULL,
+    tags TEXT NOT NULL,
+    content TEXT NOT NULL,
+    sig TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_created_at ON events (created_at);
+CREATE INDEX IF NOT EXISTS events_pubkey ON events (pubkey, created_at);
+CREATE INDEX IF NOT EXISTS events_kind ON events (kind, created_at);
+
+CREATE TABLE IF NOT EXISTS tags (
+    event_id TEXT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS tags_name_value ON tags (name, value);
+CREATE INDEX IF NOT EXISTS tags_event_id ON tags (event_id);
@@ -0,0 +1,338 @@
+// Package sqlite stores events in an SQLite database, for relays that
+// don't want to run Postgres. Full text search uses FTS5 when SQLite is
+// built with it (the sqlite_fts5 build tag) and LIKE otherwise.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var ErrClosed = errors.New("sqlite: store is closed")
+
+type addReq struct {
+	ctx context.Context
+	e   *proto.Event
+	c   chan error
+}
+
+type SqliteStore struct {
+	conn    *sql.DB
+	fts     bool
+	filters []func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)
+	ch      chan addReq
+	done    chan struct{}
+	stop    chan struct{}
+}
+
+// New opens the database at path, creating it if needed. ":memory:" gives
+// a database that is lost on close.
+func New(path string) (*SqliteStore, error) {
+	dsn := "file:" + path + "?_foreign_keys=on&_busy_timeout=5000"
+	if path != ":memory:" {
+		dsn += "&_journal_mode=WAL&_synchronous=NORMAL"
+	}
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// every connection would get its own database
+		conn.SetMaxOpenConns(1)
+	}
+
+	err = migrateDB(context.Background(), conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ss := &SqliteStore{
+		conn: conn,
+		fts:  setupSearch(context.Background(), conn),
+		ch:   make(chan addReq, 10),
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	go ss.run()
+
+	return ss, nil
+}
+
+func (ss *SqliteStore) run() {
+	defer close(ss.done)
+	for {
+		select {
+		case ar := <-ss.ch:
+			ss.add(ar)
+		case <-ss.stop:
+			// finish what was queued before Close
+			for {
+				select {
+				case ar := <-ss.ch:
+					ss.add(ar)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (ss *SqliteStore) Add(ctx context.Context, e *proto.Event) error {
+	eCh := make(chan error, 1)
+	select {
+	case ss.ch <- addReq{
+		ctx: ctx,
+		e:   e,
+		c:   eCh,
+	}:
+	case <-ss.stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-eCh:
+		return err
+	case <-ss.done:
+		// queued as the writer stopped, which may have missed it
+		select {
+		case err := <-eCh:
+			return err
+		default:
+			return ErrClosed
+		}
+	}
+}
+
+func (ss *SqliteStore) add(ar addReq) {
+	defer close(ar.c)
+	if err := ar.ctx.Err(); err != nil {
+		ar.c <- err
+		return
+	}
+	e := ar.e
+	for _, filter := range ss.filters {
+		method, f := filter(e)
+		if method == eventstore.FilterMethodDrop {
+			return
+		}
+		if method == eventstore.FilterMethodSingle {
+			if err := eventstore.Replace(ar.ctx, ss, e, f); err != nil {
+				ar.c <- err
+				return
+			}
+		}
+	}
+	ar.c <- ss.insert(ar.ctx, e)
+}
+
+func (ss *SqliteStore) insert(ctx context.Context, e *proto.Event) error {
+	tags := e.Tags
+	if tags == nil {
+		tags = [][]string{}
+	}
+	tagBuf, _ := json.Marshal(tags)
+
+	tx, err := ss.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "INSERT INTO events (id, pubkey, created_at, kind, tags, content, sig) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING", e.ID, e.PubKey, e.CreatedAt, e.Kind, string(tagBuf), e.Content, e.Sig)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = eventstore.ErrDuplicate
+		}
+		return err
+	}
+	for _, t := range tags {
+		if len(t) < 2 {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO tags (event_id, name, value) VALUES (?, ?, ?)", e.ID, t[0], t[1])
+		if err != nil {
+			return err
+		}
+	}
+	if ss.fts {
+		_, err = tx.ExecContext(ctx, "INSERT INTO events_fts (id, content) VALUES (?, ?)", e.ID, e.Content)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func stringArgs(args []interface{}, vals []string) []interface{} {
+	for _, v := range vals {
+		args = append(args, v)
+	}
+	return args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ftsQuery quotes each term so FTS5 matches it as a substring rather than
+// parsing its query syntax. Terms under three characters have no trigram
+// to look up and are left to LIKE.
+func ftsQuery(terms []string) (query string, short []string) {
+	var quoted []string
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) < 3 {
+			short = append(short, t)
+			continue
+		}
+		quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " "), short
+}
+
+func (ss *SqliteStore) buildWhereClause(filters ...*comm.Filter) (string, []interface{}) {
+	query := "WHERE ("
+	args := []interface{}{}
+	for i, filter := range filters {
+		if i != 0 {
+			query += ") OR ("
+		}
+		conds := []string{}
+		if len(filter.IDs) > 0 {
+			conds = append(conds, "id IN ("+placeholders(len(filter.IDs))+")")
+			args = stringArgs(args, filter.IDs)
+		}
+		if len(filter.Authors) > 0 {
+			// events by the author or delegated by them. Tokens are
+			// checked before events reach the store, so the tag is enough
+			in := placeholders(len(filter.Authors))
+			conds = append(conds, "(pubkey IN ("+in+") OR id IN (SELECT event_id FROM tags WHERE name = 'delegation' AND value IN ("+in+")))")
+			args = stringArgs(args, filter.Authors)
+			args = stringArgs(args, filter.Authors)
+		}
+		if len(filter.Kinds) > 0 {
+			conds = append(conds, "kind IN ("+placeholders(len(filter.Kinds))+")")
+			for _, k := range filter.Kinds {
+				args = append(args, k)
+			}
+		}
+		if filter.Since > 0 {
+			conds = append(conds, "created_at >= ?")
+			args = append(args, filter.Since)
+		}
+		if filter.Until > 0 {
+			conds = append(conds, "created_at <= ?")
+			args = append(args, filter.Until)
+		}
+		if terms := comm.SearchTerms(filter.Search); len(terms) > 0 {
+			if ss.fts {
+				var match string
+				match, terms = ftsQuery(terms)
+				if match != "" {
+					conds = append(conds, "id IN (SELECT id FROM events_fts WHERE events_fts MATCH ?)")
+					args = append(args, match)
+				}
+			}
+			for _, term := range terms {
+				conds = append(conds, `content LIKE ? ESCAPE '\'`)
+				args = append(args, "%"+likeEscaper.Replace(term)+"%")
+			}
+		}
+		for k, vals := range filter.TagFilters {
+			conds = append(conds, "id IN (SELECT event_id FROM tags WHERE name = ? AND value IN ("+placeholders(len(vals))+"))")
+			args = append(args, k)
+			args = stringArgs(args, vals)
+		}
+		if len(conds) == 0 {
+			conds = append(conds, "1")
+		}
+		query += strings.Join(conds, " AND ")
+	}
+	query += ")"
+	return query, args
+}
+
+func (ss *SqliteStore) Get(ctx context.Context, filters ...*comm.Filter) ([]*proto.Event, error) {
+	results := make([][]*proto.Event, len(filters))
+	for i, filter := range filters {
+		events, err := ss.get(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = events
+	}
+	return eventstore.Merge(results...), nil
+}
+
+func (ss *SqliteStore) get(ctx context.Context, filter *comm.Filter) ([]*proto.Event, error) {
+	query := "SELECT id, pubkey, created_at, kind, tags, content, sig FROM events "
+
+	where, args := ss.buildWhereClause(filter)
+	query += where + " ORDER BY created_at DESC, id"
+
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ss.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println("Error querying for events:", query, args, err)
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []*proto.Event{}
+	for rows.Next() {
+		e := &proto.Event{}
+		var tagraw string
+		err = rows.Scan(&e.ID, &e.PubKey, &e.CreatedAt, &e.Kind, &tagraw, &e.Content, &e.Sig)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(tagraw), &e.Tags)
+		ret = append(ret, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (ss *SqliteStore) Delete(ctx context.Context, filter *comm.Filter) error {
+	where, args := ss.buildWhereClause(filter)
+	if ss.fts {
+		_, err := ss.conn.ExecContext(ctx, "DELETE FROM events_fts WHERE id IN (SELECT id FROM events "+where+")", args...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ss.conn.ExecContext(ctx, "DELETE FROM events "+where, args...)
+	return err
+}
+
+func (ss *SqliteStore) AddFilter(f func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter)) {
+	ss.filters = append(ss.filters, f)
+}
+
+// Close waits for pending writes and closes the database.
+func (ss *SqliteStore) Close() error {
+	close(ss.stop)
+	<-ss.done
+	return ss.conn.Close()
+}
@@ -0,0 +1,193 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/relay/eventstore"
+	"github.com/andyleap/nostr/relay/eventstore/eventstoretest"
+)
+
+func TestStore(t *testing.T) {
+	ss, err := New(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	key := common.GeneratePrivateKey()
+	var events []*proto.Event
+	for i, content := range []string{"Hello World", "hello there", "goodbye world", "100% done"} {
+		e := &proto.Event{
+			Kind:      int64(1 + i%2),
+			CreatedAt: int64(1000 + i),
+			Content:   content,
+			Tags:      [][]string{{"t", content[:4]}, {"x"}},
+		}
+		e.Sign(key)
+		if err := ss.Add(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if err := ss.Add(context.Background(), events[0]); err != eventstore.ErrDuplicate {
+		t.Fatal("duplicate event stored:", err)
+	}
+
+	for _, v := range []struct {
+		name   string
+		filter *comm.Filter
+		want   []int
+	}{
+		{"all", &comm.Filter{}, []int{3, 2, 1, 0}},
+		{"ids", &comm.Filter{IDs: []string{events[2].ID, events[0].ID}}, []int{2, 0}},
+		{"authors", &comm.Filter{Authors: []string{events[0].PubKey}, Kinds: []int64{2}}, []int{3, 1}},
+		{"range", &comm.Filter{Since: 1001, Until: 1002}, []int{2, 1}},
+		{"limit", &comm.Filter{Limit: 2}, []int{3, 2}},
+		{"tags", &comm.Filter{TagFilters: map[string][]string{"t": {"Hell", "good"}}}, []int{2, 0}},
+		{"search", &comm.Filter{Search: "WORLD hello"}, []int{0}},
+		{"search like", &comm.Filter{Search: "100%"}, []int{3}},
+	} {
+		got, err := ss.Get(context.Background(), v.filter)
+		if err != nil {
+			t.Fatal(v.name, err)
+		}
+		if len(got) != len(v.want) {
+			t.Fatalf("%s: got %d events, want %d", v.name, len(got), len(v.want))
+		}
+		for i, j := range v.want {
+			if got[i].ID != events[j].ID {
+				t.Fatalf("%s: event %d is %q, want %q", v.name, i, got[i].Content, events[j].Content)
+			}
+			if v.filter.Match(got[i]) != true {
+				t.Fatalf("%s: store and Filter.Match disagree on %q", v.name, got[i].Content)
+			}
+		}
+	}
+
+	err = ss.Delete(context.Background(), &comm.Filter{TagFilters: map[string][]string{"t": {"hell"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ss.Get(context.Background(), &comm.Filter{})
+	if len(got) != 3 {
+		t.Fatal(len(got))
+	}
+	var tags int
+	ss.conn.QueryRow("SELECT count(*) FROM tags").Scan(&tags)
+	if tags != 3 {
+		t.Fatalf("%d tags left after delete", tags)
+	}
+}
+
+func TestCloseWhileWriting(t *testing.T) {
+	ss, err := New(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := common.GeneratePrivateKey()
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		e := &proto.Event{Kind: 1, CreatedAt: int64(1000 + i), Content: "closing"}
+		e.Sign(key)
+		go func() {
+			errs <- ss.Add(context.Background(), e)
+		}()
+	}
+	ss.Close()
+	for i := 0; i < 50; i++ {
+		if err := <-errs; err != nil && err != ErrClosed {
+			t.Fatal(err)
+		}
+	}
+	e := &proto.Event{Kind: 1, CreatedAt: 2000, Content: "too late"}
+	e.Sign(key)
+	if err := ss.Add(context.Background(), e); err != ErrClosed {
+		t.Fatalf("Add after Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	eventstoretest.Run(t, func(t *testing.T) eventstore.EventStore {
+		ss, err := New(filepath.Join(t.TempDir(), "events.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ss.Close() })
+		return ss
+	})
+}
+
+func TestSearchBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	ss, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &proto.Event{Kind: 1, CreatedAt: 1000, Content: "find this needle"}
+	e.Sign(common.GeneratePrivateKey())
+	if err := ss.Add(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	// as if stored by a build without FTS5
+	if ss.fts {
+		_, err = ss.conn.Exec("DELETE FROM events_fts")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ss.Close()
+
+	ss, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	got, err := ss.Get(context.Background(), &comm.Filter{Search: "needle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != e.ID {
+		t.Fatal("old event not found by search:", got)
+	}
+}
+
+func TestSearchWordIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	ss, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ss.fts {
+		ss.Close()
+		t.Skip("SQLite built without FTS5")
+	}
+	e := &proto.Event{Kind: 1, CreatedAt: 1000, Content: "find this needle"}
+	e.Sign(common.GeneratePrivateKey())
+	if err := ss.Add(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	// as indexed by an older version, by whole words
+	_, err = ss.conn.Exec("DROP TABLE events_fts; CREATE VIRTUAL TABLE events_fts USING fts5(id UNINDEXED, content); INSERT INTO events_fts SELECT id, content FROM events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Close()
+
+	ss, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	got, err := ss.Get(context.Background(), &comm.Filter{Search: "eedl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != e.ID {
+		t.Fatal("event not found by part of a word:", got)
+	}
+}
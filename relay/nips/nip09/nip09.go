@@ -1,6 +1,8 @@
 package nip09
 
 import (
+	"context"
+
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
 	"github.com/andyleap/nostr/relay"
@@ -14,8 +16,8 @@ func Attach(r *relay.Relay) {
 			switch e.Kind {
 			case 5:
 				for _, t := range e.Tags {
-					if t[0] == "e" {
-						r.EventStore().Delete(&comm.Filter{
+					if len(t) >= 2 && t[0] == "e" {
+						r.EventStore().Delete(context.Background(), &comm.Filter{
 							IDs:     []string{t[1]},
 							Authors: []string{e.PubKey},
 						})
@@ -8,17 +8,21 @@ import (
 )
 
 func Attach(r *relay.Relay) {
-	r.EventStore().(eventstore.StoreFilterer).AddFilter(func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
-		if e.Kind >= 20000 && e.Kind < 30000 {
-			return eventstore.FilterMethodDrop, nil
-		}
-		if e.Kind >= 10000 && e.Kind < 20000 {
-			return eventstore.FilterMethodSingle, &comm.Filter{
-				Kinds:   []int64{e.Kind},
-				Authors: []string{e.PubKey},
-			}
-		}
-		return eventstore.FilterMethodNormal, nil
-	})
+	r.EventStore().(eventstore.StoreFilterer).AddFilter(StoreFilter)
 	r.AddNip(16)
 }
+
+// StoreFilter drops ephemeral events and keeps only the latest replaceable
+// event of each kind and pubkey.
+func StoreFilter(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
+	if e.Kind >= 20000 && e.Kind < 30000 {
+		return eventstore.FilterMethodDrop, nil
+	}
+	if e.Kind >= 10000 && e.Kind < 20000 {
+		return eventstore.FilterMethodSingle, &comm.Filter{
+			Kinds:   []int64{e.Kind},
+			Authors: []string{e.PubKey},
+		}
+	}
+	return eventstore.FilterMethodNormal, nil
+}
@@ -8,24 +8,28 @@ import (
 )
 
 func Attach(r *relay.Relay) {
-	r.EventStore().(eventstore.StoreFilterer).AddFilter(func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
-		if e.Kind >= 30000 && e.Kind < 40000 {
-			d := ""
-			for _, t := range e.Tags {
-				if t[0] == "d" {
-					d = t[1]
-					break
-				}
-			}
-			return eventstore.FilterMethodSingle, &comm.Filter{
-				Kinds:   []int64{e.Kind},
-				Authors: []string{e.PubKey},
-				TagFilters: map[string][]string{
-					"d": {d},
-				},
+	r.EventStore().(eventstore.StoreFilterer).AddFilter(StoreFilter)
+	r.AddNip(33)
+}
+
+// StoreFilter keeps only the latest parameterized replaceable event of
+// each kind, pubkey and d tag.
+func StoreFilter(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
+	if e.Kind >= 30000 && e.Kind < 40000 {
+		d := ""
+		for _, t := range e.Tags {
+			if len(t) >= 2 && t[0] == "d" {
+				d = t[1]
+				break
 			}
 		}
-		return eventstore.FilterMethodNormal, nil
-	})
-	r.AddNip(33)
+		return eventstore.FilterMethodSingle, &comm.Filter{
+			Kinds:   []int64{e.Kind},
+			Authors: []string{e.PubKey},
+			TagFilters: map[string][]string{
+				"d": {d},
+			},
+		}
+	}
+	return eventstore.FilterMethodNormal, nil
 }
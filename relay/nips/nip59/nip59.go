@@ -0,0 +1,26 @@
+package nip59
+
+import (
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/relay"
+)
+
+// Attach restricts gift wraps (kind 1059) to connections that have
+// authenticated as the p tagged recipient.
+func Attach(r *relay.Relay) {
+	r.AddOutputFilter(func(e *proto.Event, pubKey string) bool {
+		if e.Kind != 1059 {
+			return true
+		}
+		if pubKey == "" {
+			return false
+		}
+		for _, t := range e.Tags {
+			if len(t) >= 2 && t[0] == "p" && t[1] == pubKey {
+				return true
+			}
+		}
+		return false
+	})
+	r.AddNip(59)
+}
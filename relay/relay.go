@@ -1,26 +1,47 @@
 package relay
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 
 	"nhooyr.io/websocket"
 
 	"github.com/andyleap/nostr/common"
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip42"
 	"github.com/andyleap/nostr/relay/eventstore"
 	"github.com/andyleap/nostr/relay/eventstream"
 )
 
+var (
+	errBlocked = errors.New("blocked: event not accepted by this relay")
+	errStore   = errors.New("error: could not store event")
+)
+
+// DefaultLimit and MaxLimit are the limits applied to subscription filters
+// until SetLimits changes them.
+const (
+	DefaultLimit = 500
+	MaxLimit     = 5000
+)
+
 type Relay struct {
 	es *eventstream.EventStream
 
 	store eventstore.EventStore
 
-	filters []func(*proto.Event) bool
+	filters       []func(*proto.Event) bool
+	outputFilters []func(e *proto.Event, pubKey string) bool
+
+	defaultLimit int64
+	maxLimit     int64
 
 	rd relayData
 }
@@ -28,39 +49,68 @@ type Relay struct {
 func New(store eventstore.EventStore) *Relay {
 	es := eventstream.New()
 	go es.Run()
-	ch := es.Subscribe("store", make(chan *proto.Event, 100))
-	go func() {
-		for e := range ch {
-			err := store.Add(e)
-			if err != nil {
-				log.Println("Error storing event", err)
-			}
-		}
-	}()
 	if sf, ok := store.(eventstore.StoreFilterer); ok {
-		sf.AddFilter(func(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
-			if e.Kind == 0 || e.Kind == 3 {
-				return eventstore.FilterMethodSingle, &comm.Filter{
-					Authors: []string{e.PubKey},
-					Kinds:   []int64{e.Kind},
-				}
-			}
-			return eventstore.FilterMethodNormal, nil
-		})
+		sf.AddFilter(StoreFilter)
 	}
 	rd := relayData{
 		Name:          "Nostr Relay",
 		Description:   "Relay running https://github.com/andyleap/nostr",
-		SupportedNIPs: []int{1, 11},
+		SupportedNIPs: []int{1, 11, 42, 50},
+		Limitation: &limitation{
+			MaxLimit:     MaxLimit,
+			DefaultLimit: DefaultLimit,
+		},
 	}
 
 	return &Relay{
-		es:    es,
-		store: store,
-		rd:    rd,
+		es:           es,
+		store:        store,
+		defaultLimit: DefaultLimit,
+		maxLimit:     MaxLimit,
+		rd:           rd,
 	}
 }
 
+// SetLimits sets the limit given to subscription filters without one, and
+// the most events a filter may ask for.
+func (r *Relay) SetLimits(defaultLimit, maxLimit int64) {
+	if defaultLimit > maxLimit {
+		defaultLimit = maxLimit
+	}
+	r.defaultLimit = defaultLimit
+	r.maxLimit = maxLimit
+	r.rd.Limitation.DefaultLimit = defaultLimit
+	r.rd.Limitation.MaxLimit = maxLimit
+}
+
+// limit returns copies of filters with the relay's limits applied.
+func (r *Relay) limit(filters []*comm.Filter) []*comm.Filter {
+	ret := make([]*comm.Filter, len(filters))
+	for i, f := range filters {
+		l := *f
+		if l.Limit <= 0 {
+			l.Limit = r.defaultLimit
+		}
+		if l.Limit > r.maxLimit {
+			l.Limit = r.maxLimit
+		}
+		ret[i] = &l
+	}
+	return ret
+}
+
+// StoreFilter keeps only the latest metadata and contact list of each
+// pubkey.
+func StoreFilter(e *proto.Event) (eventstore.FilterMethod, *comm.Filter) {
+	if e.Kind == 0 || e.Kind == 3 {
+		return eventstore.FilterMethodSingle, &comm.Filter{
+			Authors: []string{e.PubKey},
+			Kinds:   []int64{e.Kind},
+		}
+	}
+	return eventstore.FilterMethodNormal, nil
+}
+
 func (r *Relay) AddNip(nip int) {
 	r.rd.SupportedNIPs = append(r.rd.SupportedNIPs, nip)
 }
@@ -69,6 +119,75 @@ func (r *Relay) AddFilter(f func(*proto.Event) bool) {
 	r.filters = append(r.filters, f)
 }
 
+// AddOutputFilter adds a filter deciding whether an event may be sent to a
+// connection. pubKey is the NIP-42 authenticated key of the connection, or
+// empty if it hasn't authenticated.
+func (r *Relay) AddOutputFilter(f func(e *proto.Event, pubKey string) bool) {
+	r.outputFilters = append(r.outputFilters, f)
+}
+
+func (r *Relay) canSend(e *proto.Event, pubKey string) bool {
+	for _, f := range r.outputFilters {
+		if !f(e, pubKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// accept checks an event can be published, returning the reason for the
+// OK message if not.
+func (r *Relay) accept(e *proto.Event) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("invalid: %w", err)
+	}
+	if _, err := e.CheckDelegation(); err != nil && err != proto.ErrNoDelegation {
+		return fmt.Errorf("invalid: %w", err)
+	}
+	for _, f := range r.filters {
+		if !f(e) {
+			return errBlocked
+		}
+	}
+	return nil
+}
+
+// publish stores an accepted event and sends it to subscribers, returning
+// the reason for the OK message if it wasn't. Events the store already
+// has, or has a newer version of, are not sent, and the store's error is
+// returned as it is.
+func (r *Relay) publish(ctx context.Context, e *proto.Event) error {
+	if err := r.accept(e); err != nil {
+		return err
+	}
+	err := r.store.Add(ctx, e)
+	if err == eventstore.ErrDuplicate || err == eventstore.ErrSuperseded {
+		return err
+	}
+	if err != nil {
+		log.Println("Error storing event", err)
+		return errStore
+	}
+	r.es.Publish(e)
+	return nil
+}
+
+// backfill sends the stored events matching filters as they are read from
+// the store, stopping early if ctx is cancelled.
+func (r *Relay) backfill(ctx context.Context, filters []*comm.Filter, pubKey func() string, send func(e *proto.Event)) error {
+	it, err := eventstore.Query(ctx, r.store, r.limit(filters)...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if e := it.Event(); r.canSend(e, pubKey()) {
+			send(e)
+		}
+	}
+	return it.Err()
+}
+
 func (r *Relay) EventStream() *eventstream.EventStream {
 	return r.es
 }
@@ -97,6 +216,13 @@ type relayData struct {
 	SupportedNIPs  []int  `json:"supported_nips"`
 	Software       string `json:"software,omitempty"`
 	SoftwareVerion string `json:"version,omitempty"`
+
+	Limitation *limitation `json:"limitation,omitempty"`
+}
+
+type limitation struct {
+	MaxLimit     int64 `json:"max_limit"`
+	DefaultLimit int64 `json:"default_limit"`
 }
 
 func (r *Relay) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -134,6 +260,20 @@ func (r *Relay) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 	ctx := req.Context()
 	connID := common.RandID()
+	relayHost := req.Host
+
+	challenge := common.RandID()
+	var authMu sync.Mutex
+	authed := ""
+	authedPubKey := func() string {
+		authMu.Lock()
+		defer authMu.Unlock()
+		return authed
+	}
+	// cancels the goroutines serving each subscription
+	subs := map[string]context.CancelFunc{}
+	authReq, _ := (&comm.AuthChallenge{Challenge: challenge}).MarshalJSON()
+	conn.Write(ctx, websocket.MessageText, authReq)
 
 	for {
 		mt, buf, err := conn.Read(ctx)
@@ -155,64 +295,94 @@ func (r *Relay) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 		switch req := req.(type) {
 		case *comm.Publish:
-			log.Println("Publish", string(buf))
-			if !req.Event.CheckSig() {
-				log.Println("Invalid signature")
+			if req.Event == nil {
 				continue
 			}
-			deny := false
-			for _, f := range r.filters {
-				if !f(req.Event) {
-					deny = true
-					break
-				}
-			}
-			if deny {
-				log.Println("Denied by filter")
-				continue
+			log.Println("Publish", string(buf))
+			ok := &comm.OK{ID: req.Event.ID}
+			switch err := r.publish(ctx, req.Event); err {
+			case nil:
+				ok.Accepted = true
+			case eventstore.ErrDuplicate, eventstore.ErrSuperseded:
+				ok.Accepted = true
+				ok.Msg = err.Error()
+			default:
+				log.Println("Rejected event", err)
+				ok.Msg = err.Error()
 			}
-			r.es.Publish(req.Event)
+			buf, _ := ok.MarshalJSON()
+			conn.Write(ctx, websocket.MessageText, buf)
 		case *comm.Subscribe:
+			if cancel, ok := subs[req.ID]; ok {
+				cancel()
+			}
+			subCtx, cancel := context.WithCancel(ctx)
+			subs[req.ID] = cancel
 			ch := r.es.Subscribe(connID+"-"+req.ID, nil)
 			go func() {
-				backfill, err := r.store.Get(req.Filters...)
-				if err != nil {
-					log.Println("Error getting backfill", err)
-					conn.Close(websocket.StatusInternalError, "Error getting backfill")
-					return
-				}
-				for _, e := range backfill {
+				send := func(e *proto.Event) {
 					resp := &comm.Event{
 						ID:    req.ID,
 						Event: e,
 					}
-					e, _ := resp.MarshalJSON()
-					conn.Write(ctx, websocket.MessageText, e)
+					buf, _ := resp.MarshalJSON()
+					conn.Write(subCtx, websocket.MessageText, buf)
+				}
+				err := r.backfill(subCtx, req.Filters, authedPubKey, send)
+				if subCtx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Println("Error getting backfill", err)
+					conn.Close(websocket.StatusInternalError, "Error getting backfill")
+					return
 				}
 				resp := &comm.EndOfStoredEvents{ID: req.ID}
-				e, _ := resp.MarshalJSON()
-				conn.Write(ctx, websocket.MessageText, e)
-				for e := range ch {
-					good := false
-					for _, f := range req.Filters {
-						if f.Match(e) {
-							good = true
-							break
+				buf, _ := resp.MarshalJSON()
+				conn.Write(subCtx, websocket.MessageText, buf)
+				for {
+					select {
+					case e, ok := <-ch:
+						if !ok {
+							return
 						}
+						good := false
+						for _, f := range req.Filters {
+							if f.Match(e) {
+								good = true
+								break
+							}
+						}
+						if good && r.canSend(e, authedPubKey()) {
+							send(e)
+						}
+					case <-subCtx.Done():
+						return
 					}
-					if !good {
-						continue
-					}
-					resp := &comm.Event{
-						ID:    req.ID,
-						Event: e,
-					}
-					e, _ := resp.MarshalJSON()
-					conn.Write(ctx, websocket.MessageText, e)
 				}
 			}()
 		case *comm.Close:
+			if cancel, ok := subs[req.ID]; ok {
+				cancel()
+				delete(subs, req.ID)
+			}
 			r.es.Unsubscribe(connID + "-" + req.ID)
+		case *comm.Auth:
+			if req.Event == nil {
+				continue
+			}
+			ok := &comm.OK{ID: req.Event.ID}
+			pubKey, err := nip42.Validate(req.Event, challenge, relayHost)
+			if err != nil {
+				ok.Msg = "invalid: " + err.Error()
+			} else {
+				authMu.Lock()
+				authed = pubKey
+				authMu.Unlock()
+				ok.Accepted = true
+			}
+			buf, _ := ok.MarshalJSON()
+			conn.Write(ctx, websocket.MessageText, buf)
 		}
 
 	}
@@ -11,17 +11,23 @@ import (
 	"github.com/andyleap/nostr/common"
 	"github.com/andyleap/nostr/proto"
 	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/proto/nip17"
 	"github.com/andyleap/nostr/relay"
+	"github.com/andyleap/nostr/relay/eventstore"
 	"github.com/andyleap/nostr/relay/eventstore/memory"
 	"github.com/andyleap/nostr/relay/nips/nip09"
 	"github.com/andyleap/nostr/relay/nips/nip16"
 	"github.com/andyleap/nostr/relay/nips/nip33"
+	"github.com/andyleap/nostr/relay/nips/nip59"
+	"github.com/andyleap/nostr/signer"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"nhooyr.io/websocket"
 )
 
 var (
 	relayServer *relay.Relay
 	relayClient *client.Client
+	relayURL    string
 	privKey     *secp256k1.PrivateKey
 )
 
@@ -204,17 +210,20 @@ func TestDelete(t *testing.T) {
 }
 
 func TestReplacable(t *testing.T) {
+	now := time.Now().Unix()
 	e := &proto.Event{
-		Kind:    10000,
-		Content: common.RandID(),
+		Kind:      10000,
+		CreatedAt: now,
+		Content:   common.RandID(),
 	}
 	e.Sign(privKey)
 	relayClient.Publish(context.Background(), e)
 	id := e.ID
 
 	e = &proto.Event{
-		Kind:    10000,
-		Content: common.RandID(),
+		Kind:      10000,
+		CreatedAt: now + 1,
+		Content:   common.RandID(),
 	}
 	e.Sign(privKey)
 	relayClient.Publish(context.Background(), e)
@@ -306,14 +315,188 @@ func TestEphemeralTransmitted(t *testing.T) {
 	}
 }
 
+func TestGiftWrapRequiresAuth(t *testing.T) {
+	recipient := common.GeneratePrivateKey()
+	recipientPK := common.PubKeyHex(recipient.PubKey())
+	msg := nip17.NewMessage(common.PubKeyHex(privKey.PubKey()), []string{recipientPK}, common.RandID())
+	wraps, err := nip17.Wrap(context.Background(), signer.NewKeySigner(privKey), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayClient.Publish(context.Background(), wraps[0])
+	time.Sleep(time.Millisecond * 100)
+
+	filter := &comm.Filter{
+		IDs:   []string{wraps[0].ID},
+		Limit: 100,
+	}
+	c, err := client.Dial(context.Background(), relayURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	sub, err := c.Subscribe(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-sub.Events():
+		t.Fatal("gift wrap sent to unauthenticated connection", e.ID)
+	case <-sub.Backfilling():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	err = c.Auth(context.Background(), signer.NewKeySigner(privKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err = c.Subscribe(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-sub.Events():
+		t.Fatal("gift wrap sent to the wrong pubkey", e.ID)
+	case <-sub.Backfilling():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	c2, err := client.Dial(context.Background(), relayURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	err = c2.Auth(context.Background(), signer.NewKeySigner(recipient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err = c2.Subscribe(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-sub.Events():
+		got, err := nip17.Open(context.Background(), signer.NewKeySigner(recipient), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Content != msg.Content {
+			t.Fatal("wrong content")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestRejectReason(t *testing.T) {
+	ctx := context.Background()
+	conn, _, err := websocket.Dial(ctx, relayURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	e := &proto.Event{
+		Kind:    1,
+		Content: common.RandID(),
+	}
+	e.Sign(privKey)
+	e.Content = "tampered"
+	buf, _ := (&comm.Publish{Event: e}).MarshalJSON()
+	conn.Write(ctx, websocket.MessageText, buf)
+	for {
+		_, buf, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := comm.ParseResp(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, isOK := resp.(*comm.OK); isOK {
+			if ok.ID != e.ID || ok.Accepted || ok.Msg != "invalid: "+proto.ErrIDMismatch.Error() {
+				t.Fatal(string(buf))
+			}
+			return
+		}
+	}
+}
+
+func TestDuplicateOK(t *testing.T) {
+	ctx := context.Background()
+	conn, _, err := websocket.Dial(ctx, relayURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	now := time.Now().Unix()
+	e := &proto.Event{
+		Kind:    1,
+		Content: common.RandID(),
+	}
+	e.Sign(privKey)
+	newer := &proto.Event{Kind: 10050, CreatedAt: now, Content: common.RandID()}
+	newer.Sign(privKey)
+	older := &proto.Event{Kind: 10050, CreatedAt: now - 10, Content: common.RandID()}
+	older.Sign(privKey)
+
+	sub, err := relayClient.Subscribe(ctx, &comm.Filter{IDs: []string{older.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	for _, v := range []struct {
+		e   *proto.Event
+		msg string
+	}{
+		{e, ""},
+		{e, eventstore.ErrDuplicate.Error()},
+		{newer, ""},
+		{older, eventstore.ErrSuperseded.Error()},
+	} {
+		buf, _ := (&comm.Publish{Event: v.e}).MarshalJSON()
+		conn.Write(ctx, websocket.MessageText, buf)
+		for {
+			_, resp, err := conn.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := comm.ParseResp(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, isOK := r.(*comm.OK); isOK {
+				if ok.ID != v.e.ID || !ok.Accepted || ok.Msg != v.msg {
+					t.Fatal(string(resp))
+				}
+				break
+			}
+		}
+	}
+
+	// the older event wasn't stored, so isn't sent to subscribers either
+	select {
+	case e := <-sub.Events():
+		t.Fatal("superseded event published:", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
 func withRelayClient(f func(*relay.Relay, *client.Client)) {
 	ms := memory.New()
 	r := relay.New(ms)
 	nip09.Attach(r)
 	nip16.Attach(r)
 	nip33.Attach(r)
+	nip59.Attach(r)
 	wsServe := httptest.NewServer(r)
 	defer wsServe.Close()
+	relayURL = wsServe.URL
 	ctx := context.Background()
 	c, err := client.Dial(ctx, wsServe.URL)
 	if err != nil {
@@ -321,3 +504,102 @@ func withRelayClient(f func(*relay.Relay, *client.Client)) {
 	}
 	f(r, c)
 }
+
+func TestDelegatedAuthor(t *testing.T) {
+	delegatee := common.GeneratePrivateKey()
+	delegateePK := common.PubKeyHex(delegatee.PubKey())
+	delegatorPK := common.PubKeyHex(privKey.PubKey())
+	tag, err := proto.NewDelegation(privKey, delegateePK, &proto.Conditions{Kinds: []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := &proto.Event{Kind: 1, Content: common.RandID(), CreatedAt: time.Now().Unix()}
+	good.SetDelegation(tag)
+	good.Sign(delegatee)
+	bad := &proto.Event{Kind: 7, Content: common.RandID(), CreatedAt: time.Now().Unix()}
+	bad.SetDelegation(tag)
+	bad.Sign(delegatee)
+	relayClient.Publish(context.Background(), good)
+	relayClient.Publish(context.Background(), bad)
+	time.Sleep(time.Millisecond * 100)
+
+	sub, err := relayClient.Subscribe(context.Background(), &comm.Filter{
+		Authors: []string{delegatorPK},
+		IDs:     []string{good.ID, bad.ID},
+		Limit:   10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-sub.Events():
+		if e.ID != good.ID {
+			t.Fatal("event outside delegation conditions was stored", e.ID)
+		}
+	case <-sub.Backfilling():
+		t.Fatal("delegated event not found by delegator")
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case e := <-sub.Events():
+		t.Fatal("unexpected event", e.ID)
+	case <-sub.Backfilling():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	r := relay.New(memory.New())
+	r.SetLimits(2, 3)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	c, err := client.Dial(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		e := &proto.Event{Kind: int64(1 + i%2), CreatedAt: now + int64(i), Content: common.RandID()}
+		e.Sign(privKey)
+		c.Publish(context.Background(), e)
+		ids = append(ids, e.ID)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	for _, test := range []struct {
+		filters []*comm.Filter
+		want    []string
+	}{
+		{[]*comm.Filter{{}}, []string{ids[4], ids[3]}},
+		{[]*comm.Filter{{Limit: 10}}, []string{ids[4], ids[3], ids[2]}},
+		{[]*comm.Filter{{Kinds: []int64{1}, Limit: 1}, {Kinds: []int64{2}}}, []string{ids[4], ids[3], ids[1]}},
+	} {
+		sub, err := c.Subscribe(context.Background(), test.filters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+	backfill:
+		for {
+			select {
+			case e := <-sub.Events():
+				got = append(got, e.ID)
+			case <-sub.Backfilling():
+				break backfill
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("got %d events, want %d", len(got), len(test.want))
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("event %d is %s, want %s", i, got[i], test.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/signer"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Bunker answers remote signing requests for the keys it holds. Clients
+// must be granted permissions per key, either up front with Allow or by
+// connecting with a secret registered with AddSecret.
+type Bunker struct {
+	mu      sync.Mutex
+	signers map[string]signer.Signer
+	clients map[string]map[string]Permissions
+	secrets map[string]Permissions
+
+	// OnConnect is called when a client is granted permissions by
+	// connecting with a secret, so the grant can be persisted.
+	OnConnect func(pubKey, clientPubKey, secret string, perms Permissions)
+}
+
+func NewBunker() *Bunker {
+	return &Bunker{
+		signers: map[string]signer.Signer{},
+		clients: map[string]map[string]Permissions{},
+		secrets: map[string]Permissions{},
+	}
+}
+
+// AddKey adds a key to the bunker and returns its public key, which is
+// also the pubkey clients address requests to.
+func (b *Bunker) AddKey(key *secp256k1.PrivateKey) string {
+	s := signer.NewKeySigner(key)
+	pk, _ := s.GetPublicKey(context.Background())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.signers[pk] = s
+	return pk
+}
+
+func (b *Bunker) PubKeys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := make([]string, 0, len(b.signers))
+	for pk := range b.signers {
+		ret = append(ret, pk)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Allow grants clientPubKey perms on the key pubKey, replacing any earlier
+// grant.
+func (b *Bunker) Allow(pubKey, clientPubKey string, perms Permissions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[pubKey] == nil {
+		b.clients[pubKey] = map[string]Permissions{}
+	}
+	b.clients[pubKey][clientPubKey] = perms
+}
+
+// AddSecret registers a single use connect secret. A client connecting
+// with it is granted perms, or the permissions it asked for if perms is
+// empty.
+func (b *Bunker) AddSecret(secret string, perms Permissions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.secrets[secret] = perms
+}
+
+func (b *Bunker) lookup(pubKey, clientPubKey string) (signer.Signer, Permissions, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.signers[pubKey]
+	if !ok {
+		return nil, nil, false, ErrUnknownSigner
+	}
+	perms, ok := b.clients[pubKey][clientPubKey]
+	return s, perms, ok, nil
+}
+
+// connect checks a connect request's secret, granting permissions if it
+// is valid.
+func (b *Bunker) connect(pubKey, clientPubKey string, params []string) bool {
+	if len(params) < 2 || params[1] == "" {
+		return false
+	}
+	b.mu.Lock()
+	perms, ok := b.secrets[params[1]]
+	if !ok {
+		b.mu.Unlock()
+		return false
+	}
+	delete(b.secrets, params[1])
+	if len(perms) == 0 && len(params) >= 3 {
+		perms = ParsePermissions(params[2])
+	}
+	if b.clients[pubKey] == nil {
+		b.clients[pubKey] = map[string]Permissions{}
+	}
+	b.clients[pubKey][clientPubKey] = perms
+	onConnect := b.OnConnect
+	b.mu.Unlock()
+	if onConnect != nil {
+		onConnect(pubKey, clientPubKey, params[1], perms)
+	}
+	return true
+}
+
+// Handle answers a single request event, returning the signed response
+// event to publish.
+func (b *Bunker) Handle(ctx context.Context, e *proto.Event) (*proto.Event, error) {
+	pubKey, err := recipient(e)
+	if err != nil {
+		return nil, err
+	}
+	s, perms, allowed, err := b.lookup(pubKey, e.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{}
+	legacy, err := readMessage(ctx, s, e, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{ID: req.ID}
+	switch {
+	case req.Method == MethodConnect:
+		if allowed || b.connect(pubKey, e.PubKey, req.Params) {
+			resp.Result = "ack"
+		} else {
+			resp.Error = "unauthorized"
+		}
+	case !allowed:
+		resp.Error = "unauthorized"
+	default:
+		resp.Result, err = b.call(ctx, s, perms, req)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return newMessage(ctx, s, e.PubKey, resp, legacy)
+}
+
+var (
+	errNotPermitted  = errors.New("not permitted")
+	errBadParams     = errors.New("invalid params")
+	errUnknownMethod = errors.New("unsupported method")
+)
+
+func (b *Bunker) call(ctx context.Context, s signer.Signer, perms Permissions, req *Request) (string, error) {
+	switch req.Method {
+	case MethodPing:
+		return "pong", nil
+	case MethodGetPublicKey:
+		return s.GetPublicKey(ctx)
+	case MethodSignEvent:
+		if len(req.Params) < 1 {
+			return "", errBadParams
+		}
+		e := &proto.Event{}
+		err := json.Unmarshal([]byte(req.Params[0]), e)
+		if err != nil {
+			return "", errBadParams
+		}
+		if !perms.Allows(MethodSignEvent, e.Kind) {
+			return "", errNotPermitted
+		}
+		if e.Tags == nil {
+			e.Tags = [][]string{}
+		}
+		err = s.SignEvent(ctx, e)
+		if err != nil {
+			return "", err
+		}
+		buf, err := json.Marshal(e)
+		return string(buf), err
+	case MethodNip04Encrypt, MethodNip04Decrypt, MethodNip44Encrypt, MethodNip44Decrypt:
+		if len(req.Params) < 2 {
+			return "", errBadParams
+		}
+		if !perms.Allows(req.Method, 0) {
+			return "", errNotPermitted
+		}
+		switch req.Method {
+		case MethodNip04Encrypt:
+			return s.Nip04Encrypt(ctx, req.Params[0], req.Params[1])
+		case MethodNip04Decrypt:
+			return s.Nip04Decrypt(ctx, req.Params[0], req.Params[1])
+		case MethodNip44Encrypt:
+			return s.Nip44Encrypt(ctx, req.Params[0], req.Params[1])
+		default:
+			return s.Nip44Decrypt(ctx, req.Params[0], req.Params[1])
+		}
+	}
+	return "", errUnknownMethod
+}
+
+// Serve answers requests arriving on c until ctx is done or the
+// subscription ends. Keys added after Serve starts are not listened for.
+func (b *Bunker) Serve(ctx context.Context, c *client.Client) error {
+	sub, err := c.Subscribe(ctx, &comm.Filter{
+		Kinds:      []int64{KindNostrConnect},
+		TagFilters: map[string][]string{"p": b.PubKeys()},
+		Since:      time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return ErrDisconnected
+			}
+			resp, err := b.Handle(ctx, e)
+			if err != nil {
+				continue
+			}
+			err = c.Publish(ctx, resp)
+			if err != nil {
+				return err
+			}
+		case <-c.Done():
+			return ErrDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package nip46 implements remote signing ("nostr connect"): a bunker
+// holds keys and answers kind 24133 requests that clients send to it over
+// a relay, and Remote is a signer.Signer that forwards to a bunker.
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/signer"
+)
+
+const KindNostrConnect = 24133
+
+const (
+	MethodConnect      = "connect"
+	MethodPing         = "ping"
+	MethodGetPublicKey = "get_public_key"
+	MethodSignEvent    = "sign_event"
+	MethodNip04Encrypt = "nip04_encrypt"
+	MethodNip04Decrypt = "nip04_decrypt"
+	MethodNip44Encrypt = "nip44_encrypt"
+	MethodNip44Decrypt = "nip44_decrypt"
+)
+
+const BunkerScheme = "bunker://"
+
+var (
+	ErrInvalidURI     = errors.New("nip46: invalid bunker uri")
+	ErrWrongKind      = errors.New("nip46: wrong event kind")
+	ErrBadSignature   = errors.New("nip46: invalid signature")
+	ErrNoRecipient    = errors.New("nip46: message has no p tag")
+	ErrUnknownSigner  = errors.New("nip46: no key for recipient")
+	ErrBadResponse    = errors.New("nip46: signer returned a bad event")
+	ErrConnectRefused = errors.New("nip46: connect refused")
+	ErrDisconnected   = errors.New("nip46: relay subscription closed")
+)
+
+type Request struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+type Response struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BunkerURI is the bunker://<pubkey>?relay=...&secret=... connection
+// string a bunker hands out to clients.
+type BunkerURI struct {
+	PubKey string
+	Relays []string
+	Secret string
+}
+
+func ParseBunkerURI(s string) (*BunkerURI, error) {
+	if !strings.HasPrefix(s, BunkerScheme) {
+		return nil, ErrInvalidURI
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, ErrInvalidURI
+	}
+	pk := u.Host
+	if _, err := common.ParsePubKeyHex(pk); err != nil || strings.ToLower(pk) != pk {
+		return nil, ErrInvalidURI
+	}
+	q := u.Query()
+	if len(q["relay"]) == 0 {
+		return nil, ErrInvalidURI
+	}
+	return &BunkerURI{
+		PubKey: pk,
+		Relays: q["relay"],
+		Secret: q.Get("secret"),
+	}, nil
+}
+
+func (u *BunkerURI) String() string {
+	q := url.Values{}
+	for _, r := range u.Relays {
+		q.Add("relay", r)
+	}
+	if u.Secret != "" {
+		q.Set("secret", u.Secret)
+	}
+	return BunkerScheme + u.PubKey + "?" + q.Encode()
+}
+
+// Permissions lists the methods a client may call. An entry is a method
+// name, or "sign_event:<kind>" to allow signing a single kind.
+type Permissions []string
+
+func ParsePermissions(s string) Permissions {
+	var p Permissions
+	for _, perm := range strings.Split(s, ",") {
+		perm = strings.TrimSpace(perm)
+		if perm != "" {
+			p = append(p, perm)
+		}
+	}
+	return p
+}
+
+func (p Permissions) String() string {
+	return strings.Join(p, ",")
+}
+
+// Allows reports whether method may be called; kind is only consulted
+// for sign_event. connect, ping and get_public_key are always allowed.
+func (p Permissions) Allows(method string, kind int64) bool {
+	switch method {
+	case MethodConnect, MethodPing, MethodGetPublicKey:
+		return true
+	}
+	for _, perm := range p {
+		if perm == method {
+			return true
+		}
+		if method == MethodSignEvent && perm == MethodSignEvent+":"+strconv.FormatInt(kind, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+func recipient(e *proto.Event) (string, error) {
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == "p" {
+			return t[1], nil
+		}
+	}
+	return "", ErrNoRecipient
+}
+
+// newMessage encrypts v to the other party and returns the signed kind
+// 24133 event carrying it. legacy selects NIP-04 instead of NIP-44.
+func newMessage(ctx context.Context, s signer.Signer, to string, v interface{}, legacy bool) (*proto.Event, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var content string
+	if legacy {
+		content, err = s.Nip04Encrypt(ctx, to, string(buf))
+	} else {
+		content, err = s.Nip44Encrypt(ctx, to, string(buf))
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &proto.Event{
+		Kind:      KindNostrConnect,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			{"p", to},
+		},
+		Content: content,
+	}
+	err = s.SignEvent(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// readMessage verifies and decrypts a kind 24133 event into v, reporting
+// whether it was NIP-04 encrypted.
+func readMessage(ctx context.Context, s signer.Signer, e *proto.Event, v interface{}) (bool, error) {
+	if e.Kind != KindNostrConnect {
+		return false, ErrWrongKind
+	}
+	if !e.CheckSig() {
+		return false, ErrBadSignature
+	}
+	legacy := strings.Contains(e.Content, "?iv=")
+	var pt string
+	var err error
+	if legacy {
+		pt, err = s.Nip04Decrypt(ctx, e.PubKey, e.Content)
+	} else {
+		pt, err = s.Nip44Decrypt(ctx, e.PubKey, e.Content)
+	}
+	if err != nil {
+		return legacy, err
+	}
+	return legacy, json.Unmarshal([]byte(pt), v)
+}
@@ -0,0 +1,123 @@
+package nip46
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/relay"
+	"github.com/andyleap/nostr/relay/eventstore/memory"
+	"github.com/andyleap/nostr/signer"
+)
+
+func TestParseBunkerURI(t *testing.T) {
+	pk := common.PubKeyHex(common.GeneratePrivateKey().PubKey())
+	u, err := ParseBunkerURI(BunkerScheme + pk + "?relay=wss%3A%2F%2Fa&relay=wss://b&secret=s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PubKey != pk || len(u.Relays) != 2 || u.Relays[0] != "wss://a" || u.Relays[1] != "wss://b" || u.Secret != "s3cret" {
+		t.Fatalf("%+v", u)
+	}
+	again, err := ParseBunkerURI(u.String())
+	if err != nil || again.String() != u.String() {
+		t.Fatal(again, err)
+	}
+	for _, bad := range []string{
+		"nostrconnect://" + pk + "?relay=wss://a",
+		BunkerScheme + pk,
+		BunkerScheme + strings.ToUpper(pk) + "?relay=wss://a",
+		BunkerScheme + "abcd?relay=wss://a",
+	} {
+		if _, err := ParseBunkerURI(bad); err != ErrInvalidURI {
+			t.Error(bad, err)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	p := ParsePermissions("sign_event:1, nip44_encrypt")
+	if !p.Allows(MethodSignEvent, 1) || p.Allows(MethodSignEvent, 4) {
+		t.Fatal("sign_event:1")
+	}
+	if !p.Allows(MethodNip44Encrypt, 0) || p.Allows(MethodNip44Decrypt, 0) {
+		t.Fatal("nip44")
+	}
+	if !p.Allows(MethodGetPublicKey, 0) || !ParsePermissions("sign_event").Allows(MethodSignEvent, 30023) {
+		t.Fatal("defaults")
+	}
+}
+
+func TestRemote(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(relay.New(memory.New()))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	user := common.GeneratePrivateKey()
+	b := NewBunker()
+	pk := b.AddKey(user)
+	b.AddSecret("s3cret", ParsePermissions("sign_event:1,nip44_encrypt,nip44_decrypt"))
+	var granted string
+	b.OnConnect = func(pubKey, clientPubKey, secret string, perms Permissions) {
+		granted = clientPubKey
+	}
+	bc, err := client.Dial(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	go b.Serve(ctx, bc)
+
+	uri := &BunkerURI{PubKey: pk, Relays: []string{url}}
+	clientKey := common.GeneratePrivateKey()
+	if _, err := Connect(ctx, uri.String(), clientKey, nil); err != ErrConnectRefused {
+		t.Fatal("connected without a secret", err)
+	}
+	uri.Secret = "s3cret"
+	r, err := Connect(ctx, uri.String(), clientKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if granted != common.PubKeyHex(clientKey.PubKey()) {
+		t.Fatal("OnConnect not called")
+	}
+	if _, err := Connect(ctx, uri.String(), common.GeneratePrivateKey(), nil); err != ErrConnectRefused {
+		t.Fatal("secret reused", err)
+	}
+
+	got, err := r.GetPublicKey(ctx)
+	if err != nil || got != pk {
+		t.Fatal(got, err)
+	}
+	e := &proto.Event{Kind: 1, Content: "hello", CreatedAt: 1700000000}
+	err = r.SignEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PubKey != pk || !e.CheckSig() {
+		t.Fatalf("bad signature %+v", e)
+	}
+	if err := r.SignEvent(ctx, &proto.Event{Kind: 4}); err == nil {
+		t.Fatal("signed a kind without permission")
+	}
+
+	other := common.GeneratePrivateKey()
+	otherPK := common.PubKeyHex(other.PubKey())
+	ct, err := r.Nip44Encrypt(ctx, otherPK, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := signer.NewKeySigner(other).Nip44Decrypt(ctx, pk, ct)
+	if err != nil || pt != "secret" {
+		t.Fatal(pt, err)
+	}
+	if _, err := r.Nip04Encrypt(ctx, otherPK, "secret"); err == nil {
+		t.Fatal("nip04 without permission")
+	}
+}
@@ -0,0 +1,213 @@
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/andyleap/nostr/client"
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/comm"
+	"github.com/andyleap/nostr/signer"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// DefaultTimeout bounds each request to the bunker when the caller's
+// context has no deadline.
+const DefaultTimeout = 30 * time.Second
+
+// Remote is a signer.Signer whose key lives in a bunker.
+type Remote struct {
+	c      *client.Client
+	local  *signer.KeySigner
+	remote string
+
+	mu      sync.Mutex
+	pending map[string]chan *Response
+	pubKey  string
+}
+
+var _ signer.Signer = (*Remote)(nil)
+
+// Connect dials the first reachable relay in a bunker:// uri and connects
+// to the bunker with the client key, asking for perms. The bunker must
+// already trust the client key or the uri must carry a valid secret.
+func Connect(ctx context.Context, uri string, key *secp256k1.PrivateKey, perms Permissions) (*Remote, error) {
+	u, err := ParseBunkerURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	var c *client.Client
+	for _, relay := range u.Relays {
+		c, err = client.Dial(ctx, relay)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &Remote{
+		c:       c,
+		local:   signer.NewKeySigner(key),
+		remote:  u.PubKey,
+		pending: map[string]chan *Response{},
+	}
+	sub, err := c.Subscribe(ctx, &comm.Filter{
+		Kinds:      []int64{KindNostrConnect},
+		Authors:    []string{u.PubKey},
+		TagFilters: map[string][]string{"p": {common.PubKeyHex(key.PubKey())}},
+		Since:      time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	go r.process(sub)
+
+	_, err = r.call(ctx, MethodConnect, u.PubKey, u.Secret, perms.String())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Remote) process(sub *client.Subscription) {
+	for e := range sub.Events() {
+		resp := &Response{}
+		_, err := readMessage(context.Background(), r.local, e, resp)
+		if err != nil {
+			continue
+		}
+		r.mu.Lock()
+		ch, ok := r.pending[resp.ID]
+		delete(r.pending, resp.ID)
+		r.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+func (r *Remote) call(ctx context.Context, method string, params ...string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	req := &Request{
+		ID:     common.RandID(),
+		Method: method,
+		Params: params,
+	}
+	e, err := newMessage(ctx, r.local, r.remote, req, false)
+	if err != nil {
+		return "", err
+	}
+	ch := make(chan *Response, 1)
+	r.mu.Lock()
+	r.pending[req.ID] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, req.ID)
+		r.mu.Unlock()
+	}()
+	err = r.c.Publish(ctx, e)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			if method == MethodConnect {
+				return "", ErrConnectRefused
+			}
+			return "", errors.New("nip46: " + method + ": " + resp.Error)
+		}
+		return resp.Result, nil
+	case <-r.c.Done():
+		return "", ErrDisconnected
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (r *Remote) Close() error {
+	return r.c.Close()
+}
+
+func (r *Remote) GetPublicKey(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	pk := r.pubKey
+	r.mu.Unlock()
+	if pk != "" {
+		return pk, nil
+	}
+	pk, err := r.call(ctx, MethodGetPublicKey)
+	if err != nil {
+		return "", err
+	}
+	if _, err := common.ParsePubKeyHex(pk); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.pubKey = pk
+	r.mu.Unlock()
+	return pk, nil
+}
+
+// SignEvent has the bunker sign e, checking that the returned event is
+// validly signed by the user's key and carries the same content.
+func (r *Remote) SignEvent(ctx context.Context, e *proto.Event) error {
+	pk, err := r.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	unsigned := *e
+	unsigned.PubKey = pk
+	unsigned.ID = ""
+	unsigned.Sig = ""
+	buf, err := json.Marshal(&unsigned)
+	if err != nil {
+		return err
+	}
+	res, err := r.call(ctx, MethodSignEvent, string(buf))
+	if err != nil {
+		return err
+	}
+	signed := &proto.Event{}
+	err = json.Unmarshal([]byte(res), signed)
+	if err != nil {
+		return ErrBadResponse
+	}
+	unsigned.ID = unsigned.CalcID()
+	if signed.PubKey != pk || signed.ID != unsigned.ID || !signed.CheckSig() {
+		return ErrBadResponse
+	}
+	*e = *signed
+	return nil
+}
+
+func (r *Remote) Nip04Encrypt(ctx context.Context, pubKey, plaintext string) (string, error) {
+	return r.call(ctx, MethodNip04Encrypt, pubKey, plaintext)
+}
+
+func (r *Remote) Nip04Decrypt(ctx context.Context, pubKey, ciphertext string) (string, error) {
+	return r.call(ctx, MethodNip04Decrypt, pubKey, ciphertext)
+}
+
+func (r *Remote) Nip44Encrypt(ctx context.Context, pubKey, plaintext string) (string, error) {
+	return r.call(ctx, MethodNip44Encrypt, pubKey, plaintext)
+}
+
+func (r *Remote) Nip44Decrypt(ctx context.Context, pubKey, payload string) (string, error) {
+	return r.call(ctx, MethodNip44Decrypt, pubKey, payload)
+}
@@ -0,0 +1,79 @@
+// Package signer abstracts over where a user's private key lives, so
+// events can be signed and messages encrypted either with a local key or
+// by a remote signer.
+package signer
+
+import (
+	"context"
+
+	"github.com/andyleap/nostr/common"
+	"github.com/andyleap/nostr/proto"
+	"github.com/andyleap/nostr/proto/nip04"
+	"github.com/andyleap/nostr/proto/nip44"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Signer holds a key on the caller's behalf. The methods mirror the NIP-46
+// request methods.
+type Signer interface {
+	GetPublicKey(ctx context.Context) (string, error)
+	// SignEvent sets the event's pubkey, id and sig.
+	SignEvent(ctx context.Context, e *proto.Event) error
+	Nip04Encrypt(ctx context.Context, pubKey, plaintext string) (string, error)
+	Nip04Decrypt(ctx context.Context, pubKey, ciphertext string) (string, error)
+	Nip44Encrypt(ctx context.Context, pubKey, plaintext string) (string, error)
+	Nip44Decrypt(ctx context.Context, pubKey, payload string) (string, error)
+}
+
+// KeySigner is a Signer backed by a private key in memory.
+type KeySigner struct {
+	key    *secp256k1.PrivateKey
+	pubKey string
+}
+
+func NewKeySigner(key *secp256k1.PrivateKey) *KeySigner {
+	return &KeySigner{
+		key:    key,
+		pubKey: common.PubKeyHex(key.PubKey()),
+	}
+}
+
+func (k *KeySigner) GetPublicKey(ctx context.Context) (string, error) {
+	return k.pubKey, nil
+}
+
+func (k *KeySigner) SignEvent(ctx context.Context, e *proto.Event) error {
+	return e.Sign(k.key)
+}
+
+func (k *KeySigner) Nip04Encrypt(ctx context.Context, pubKey, plaintext string) (string, error) {
+	shared, err := nip04.SharedKey(k.key, pubKey)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Encrypt(shared, plaintext)
+}
+
+func (k *KeySigner) Nip04Decrypt(ctx context.Context, pubKey, ciphertext string) (string, error) {
+	shared, err := nip04.SharedKey(k.key, pubKey)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Decrypt(shared, ciphertext)
+}
+
+func (k *KeySigner) Nip44Encrypt(ctx context.Context, pubKey, plaintext string) (string, error) {
+	ck, err := nip44.ConversationKey(k.key, pubKey)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Encrypt(ck, plaintext)
+}
+
+func (k *KeySigner) Nip44Decrypt(ctx context.Context, pubKey, payload string) (string, error) {
+	ck, err := nip44.ConversationKey(k.key, pubKey)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Decrypt(ck, payload)
+}